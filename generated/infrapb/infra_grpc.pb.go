@@ -1,4 +1,8 @@
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.19.4
+// source: infra.proto
 
 package infrapb
 
@@ -21,17 +25,75 @@ type SecretsClient interface {
 	// Create a new Secret
 	// The claims provided in the Secret will be added into the jwt token.
 	// If provided, the "exp" claim overrides the one assigned by default. If not, the token is
-	// given the service's default validity period.
+	// given the secret's ttl, or the service's default validity period.
+	// Invalid claims, either reserved or not matching the service's schema, are rejected with an
+	// INVALID_ARGUMENT error listing every violation, also given as a google.rpc.BadRequest detail.
 	Create(ctx context.Context, in *Secret, opts ...grpc.CallOption) (*Secret, error)
 	// Update a new Secret.
-	// If provided, the jwt's claims are updated.
-	// If no "exp" claim is provided, the secret is renewed with the service's default validity period.
+	// If provided, the jwt's claims are updated, as well as the ttl and renew_before. The given
+	// claims are merged with the current ones, or replace them with replace_claims, and the claims
+	// listed in remove_claims are removed, in a single change of the secret.
+	// If no "exp" claim is provided, the secret is renewed with its validity period.
+	// The claims are checked as for Create, once merged with the current ones. The returned secret
+	// holds the resulting claims.
 	Update(ctx context.Context, in *Secret, opts ...grpc.CallOption) (*Secret, error)
 	// Delete a secret with given name.
 	// Claims are ignored.
 	Delete(ctx context.Context, in *Secret, opts ...grpc.CallOption) (*Empty, error)
-	// List all existing secrets.
-	List(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*SecretList, error)
+	// Create, update or delete several secrets at once, each item being checked as for the single
+	// RPCs. If any item is invalid, none of them is applied. The valid items are then applied
+	// atomically if the store supports it (see BatchResponse.atomic), or one by one otherwise, a
+	// failing item not stopping the others. The result of each item is given in the request order.
+	// At most 1000 items can be given at once, and a secret can only be given once per batch.
+	BatchCreate(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	BatchUpdate(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	BatchDelete(ctx context.Context, in *BatchDeleteRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	// Renew the token of a secret now, keeping its claims. The new token is valid for ttl if
+	// provided, or for the secret's validity period.
+	Renew(ctx context.Context, in *RenewRequest, opts ...grpc.CallOption) (*SecretDetails, error)
+	// Renew the tokens of every secret whose name matches the selector, a glob pattern (e.g.
+	// "eu-*"), and whose labels match the label selector, as for List. Empty selectors match every
+	// secret. A secret failing to be renewed doesn't stop the others from being renewed, the
+	// failure being reported in its result instead.
+	RenewAll(ctx context.Context, in *RenewAllRequest, opts ...grpc.CallOption) (*RenewAllResponse, error)
+	// Revoke a token of a secret, identified by its "jti" claim, until it expires. If no jti is
+	// given, the current token of the secret is revoked, and a new one is issued in its place.
+	// Any token issued for the secret can be revoked until it expires, including the ones replaced
+	// by an update or a renewal.
+	Revoke(ctx context.Context, in *RevokeRequest, opts ...grpc.CallOption) (*RevokedToken, error)
+	// List the revoked tokens which are not expired yet.
+	ListRevoked(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*RevokedTokenList, error)
+	// Watch the revoked tokens : the ones not expired yet are sent first, and then each token
+	// as soon as it is revoked. The APIs verifying the tokens should reject those tokens.
+	WatchRevoked(ctx context.Context, in *Empty, opts ...grpc.CallOption) (Secrets_WatchRevokedClient, error)
+	// Introspect a token, as described by RFC 7662 : the token is active if it was signed by one
+	// of the service's keys, and is neither expired nor revoked. Only the active flag is set
+	// for the tokens which are not active.
+	Introspect(ctx context.Context, in *IntrospectRequest, opts ...grpc.CallOption) (*IntrospectResponse, error)
+	// List the secrets of a namespace (the default one if not set), or of every namespace.
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*SecretList, error)
+	// Get a secret with given name, including its jwt token.
+	Get(ctx context.Context, in *SecretRef, opts ...grpc.CallOption) (*SecretDetails, error)
+	// Watch the changes made to the secrets of a namespace (the default one if not set) or of
+	// every namespace, including the background renewals.
+	// If from_revision is set, the events that happened after this revision are sent first, so
+	// that a client can resume watching from the last event it received. If those events are not
+	// available anymore, or if the revision is not reached yet, the call fails with an OUT_OF_RANGE
+	// status, and the client must List the secrets again before watching from the current
+	// revision. The revisions are kept in memory : they start over when the service restarts, and
+	// differ between its replicas, so a client must resync this way after a restart.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Secrets_WatchClient, error)
+	// List the last versions of a secret, the latest one coming last. A version is kept each
+	// time the claims of the secret change : when it is created, updated or rolled back, but not
+	// when it is renewed.
+	ListVersions(ctx context.Context, in *SecretRef, opts ...grpc.CallOption) (*SecretVersionList, error)
+	// Rollback a secret to the claims of one of its versions. A new token is issued from those
+	// claims, with the service's default validity period, and is kept as a new version.
+	Rollback(ctx context.Context, in *RollbackRequest, opts ...grpc.CallOption) (*SecretDetails, error)
+	// Get the public keys used to verify the jwt tokens, as a JSON Web Key Set (RFC 7517).
+	// Both the active and the still valid retired keys are published. Keys of the HMAC
+	// algorithms are secret, and thus never published.
+	GetJWKS(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*JWKS, error)
 }
 
 type secretsClient struct {
@@ -69,7 +131,111 @@ func (c *secretsClient) Delete(ctx context.Context, in *Secret, opts ...grpc.Cal
 	return out, nil
 }
 
-func (c *secretsClient) List(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*SecretList, error) {
+func (c *secretsClient) BatchCreate(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, "/Secrets/BatchCreate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *secretsClient) BatchUpdate(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, "/Secrets/BatchUpdate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *secretsClient) BatchDelete(ctx context.Context, in *BatchDeleteRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, "/Secrets/BatchDelete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *secretsClient) Renew(ctx context.Context, in *RenewRequest, opts ...grpc.CallOption) (*SecretDetails, error) {
+	out := new(SecretDetails)
+	err := c.cc.Invoke(ctx, "/Secrets/Renew", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *secretsClient) RenewAll(ctx context.Context, in *RenewAllRequest, opts ...grpc.CallOption) (*RenewAllResponse, error) {
+	out := new(RenewAllResponse)
+	err := c.cc.Invoke(ctx, "/Secrets/RenewAll", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *secretsClient) Revoke(ctx context.Context, in *RevokeRequest, opts ...grpc.CallOption) (*RevokedToken, error) {
+	out := new(RevokedToken)
+	err := c.cc.Invoke(ctx, "/Secrets/Revoke", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *secretsClient) ListRevoked(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*RevokedTokenList, error) {
+	out := new(RevokedTokenList)
+	err := c.cc.Invoke(ctx, "/Secrets/ListRevoked", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *secretsClient) WatchRevoked(ctx context.Context, in *Empty, opts ...grpc.CallOption) (Secrets_WatchRevokedClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Secrets_ServiceDesc.Streams[0], "/Secrets/WatchRevoked", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &secretsWatchRevokedClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Secrets_WatchRevokedClient interface {
+	Recv() (*RevokedToken, error)
+	grpc.ClientStream
+}
+
+type secretsWatchRevokedClient struct {
+	grpc.ClientStream
+}
+
+func (x *secretsWatchRevokedClient) Recv() (*RevokedToken, error) {
+	m := new(RevokedToken)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *secretsClient) Introspect(ctx context.Context, in *IntrospectRequest, opts ...grpc.CallOption) (*IntrospectResponse, error) {
+	out := new(IntrospectResponse)
+	err := c.cc.Invoke(ctx, "/Secrets/Introspect", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *secretsClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*SecretList, error) {
 	out := new(SecretList)
 	err := c.cc.Invoke(ctx, "/Secrets/List", in, out, opts...)
 	if err != nil {
@@ -78,6 +244,74 @@ func (c *secretsClient) List(ctx context.Context, in *Empty, opts ...grpc.CallOp
 	return out, nil
 }
 
+func (c *secretsClient) Get(ctx context.Context, in *SecretRef, opts ...grpc.CallOption) (*SecretDetails, error) {
+	out := new(SecretDetails)
+	err := c.cc.Invoke(ctx, "/Secrets/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *secretsClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Secrets_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Secrets_ServiceDesc.Streams[1], "/Secrets/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &secretsWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Secrets_WatchClient interface {
+	Recv() (*SecretEvent, error)
+	grpc.ClientStream
+}
+
+type secretsWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *secretsWatchClient) Recv() (*SecretEvent, error) {
+	m := new(SecretEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *secretsClient) ListVersions(ctx context.Context, in *SecretRef, opts ...grpc.CallOption) (*SecretVersionList, error) {
+	out := new(SecretVersionList)
+	err := c.cc.Invoke(ctx, "/Secrets/ListVersions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *secretsClient) Rollback(ctx context.Context, in *RollbackRequest, opts ...grpc.CallOption) (*SecretDetails, error) {
+	out := new(SecretDetails)
+	err := c.cc.Invoke(ctx, "/Secrets/Rollback", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *secretsClient) GetJWKS(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*JWKS, error) {
+	out := new(JWKS)
+	err := c.cc.Invoke(ctx, "/Secrets/GetJWKS", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // SecretsServer is the server API for Secrets service.
 // All implementations must embed UnimplementedSecretsServer
 // for forward compatibility
@@ -85,17 +319,75 @@ type SecretsServer interface {
 	// Create a new Secret
 	// The claims provided in the Secret will be added into the jwt token.
 	// If provided, the "exp" claim overrides the one assigned by default. If not, the token is
-	// given the service's default validity period.
+	// given the secret's ttl, or the service's default validity period.
+	// Invalid claims, either reserved or not matching the service's schema, are rejected with an
+	// INVALID_ARGUMENT error listing every violation, also given as a google.rpc.BadRequest detail.
 	Create(context.Context, *Secret) (*Secret, error)
 	// Update a new Secret.
-	// If provided, the jwt's claims are updated.
-	// If no "exp" claim is provided, the secret is renewed with the service's default validity period.
+	// If provided, the jwt's claims are updated, as well as the ttl and renew_before. The given
+	// claims are merged with the current ones, or replace them with replace_claims, and the claims
+	// listed in remove_claims are removed, in a single change of the secret.
+	// If no "exp" claim is provided, the secret is renewed with its validity period.
+	// The claims are checked as for Create, once merged with the current ones. The returned secret
+	// holds the resulting claims.
 	Update(context.Context, *Secret) (*Secret, error)
 	// Delete a secret with given name.
 	// Claims are ignored.
 	Delete(context.Context, *Secret) (*Empty, error)
-	// List all existing secrets.
-	List(context.Context, *Empty) (*SecretList, error)
+	// Create, update or delete several secrets at once, each item being checked as for the single
+	// RPCs. If any item is invalid, none of them is applied. The valid items are then applied
+	// atomically if the store supports it (see BatchResponse.atomic), or one by one otherwise, a
+	// failing item not stopping the others. The result of each item is given in the request order.
+	// At most 1000 items can be given at once, and a secret can only be given once per batch.
+	BatchCreate(context.Context, *BatchRequest) (*BatchResponse, error)
+	BatchUpdate(context.Context, *BatchRequest) (*BatchResponse, error)
+	BatchDelete(context.Context, *BatchDeleteRequest) (*BatchResponse, error)
+	// Renew the token of a secret now, keeping its claims. The new token is valid for ttl if
+	// provided, or for the secret's validity period.
+	Renew(context.Context, *RenewRequest) (*SecretDetails, error)
+	// Renew the tokens of every secret whose name matches the selector, a glob pattern (e.g.
+	// "eu-*"), and whose labels match the label selector, as for List. Empty selectors match every
+	// secret. A secret failing to be renewed doesn't stop the others from being renewed, the
+	// failure being reported in its result instead.
+	RenewAll(context.Context, *RenewAllRequest) (*RenewAllResponse, error)
+	// Revoke a token of a secret, identified by its "jti" claim, until it expires. If no jti is
+	// given, the current token of the secret is revoked, and a new one is issued in its place.
+	// Any token issued for the secret can be revoked until it expires, including the ones replaced
+	// by an update or a renewal.
+	Revoke(context.Context, *RevokeRequest) (*RevokedToken, error)
+	// List the revoked tokens which are not expired yet.
+	ListRevoked(context.Context, *Empty) (*RevokedTokenList, error)
+	// Watch the revoked tokens : the ones not expired yet are sent first, and then each token
+	// as soon as it is revoked. The APIs verifying the tokens should reject those tokens.
+	WatchRevoked(*Empty, Secrets_WatchRevokedServer) error
+	// Introspect a token, as described by RFC 7662 : the token is active if it was signed by one
+	// of the service's keys, and is neither expired nor revoked. Only the active flag is set
+	// for the tokens which are not active.
+	Introspect(context.Context, *IntrospectRequest) (*IntrospectResponse, error)
+	// List the secrets of a namespace (the default one if not set), or of every namespace.
+	List(context.Context, *ListRequest) (*SecretList, error)
+	// Get a secret with given name, including its jwt token.
+	Get(context.Context, *SecretRef) (*SecretDetails, error)
+	// Watch the changes made to the secrets of a namespace (the default one if not set) or of
+	// every namespace, including the background renewals.
+	// If from_revision is set, the events that happened after this revision are sent first, so
+	// that a client can resume watching from the last event it received. If those events are not
+	// available anymore, or if the revision is not reached yet, the call fails with an OUT_OF_RANGE
+	// status, and the client must List the secrets again before watching from the current
+	// revision. The revisions are kept in memory : they start over when the service restarts, and
+	// differ between its replicas, so a client must resync this way after a restart.
+	Watch(*WatchRequest, Secrets_WatchServer) error
+	// List the last versions of a secret, the latest one coming last. A version is kept each
+	// time the claims of the secret change : when it is created, updated or rolled back, but not
+	// when it is renewed.
+	ListVersions(context.Context, *SecretRef) (*SecretVersionList, error)
+	// Rollback a secret to the claims of one of its versions. A new token is issued from those
+	// claims, with the service's default validity period, and is kept as a new version.
+	Rollback(context.Context, *RollbackRequest) (*SecretDetails, error)
+	// Get the public keys used to verify the jwt tokens, as a JSON Web Key Set (RFC 7517).
+	// Both the active and the still valid retired keys are published. Keys of the HMAC
+	// algorithms are secret, and thus never published.
+	GetJWKS(context.Context, *Empty) (*JWKS, error)
 	mustEmbedUnimplementedSecretsServer()
 }
 
@@ -112,9 +404,51 @@ func (UnimplementedSecretsServer) Update(context.Context, *Secret) (*Secret, err
 func (UnimplementedSecretsServer) Delete(context.Context, *Secret) (*Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
 }
-func (UnimplementedSecretsServer) List(context.Context, *Empty) (*SecretList, error) {
+func (UnimplementedSecretsServer) BatchCreate(context.Context, *BatchRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchCreate not implemented")
+}
+func (UnimplementedSecretsServer) BatchUpdate(context.Context, *BatchRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchUpdate not implemented")
+}
+func (UnimplementedSecretsServer) BatchDelete(context.Context, *BatchDeleteRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchDelete not implemented")
+}
+func (UnimplementedSecretsServer) Renew(context.Context, *RenewRequest) (*SecretDetails, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Renew not implemented")
+}
+func (UnimplementedSecretsServer) RenewAll(context.Context, *RenewAllRequest) (*RenewAllResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RenewAll not implemented")
+}
+func (UnimplementedSecretsServer) Revoke(context.Context, *RevokeRequest) (*RevokedToken, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Revoke not implemented")
+}
+func (UnimplementedSecretsServer) ListRevoked(context.Context, *Empty) (*RevokedTokenList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRevoked not implemented")
+}
+func (UnimplementedSecretsServer) WatchRevoked(*Empty, Secrets_WatchRevokedServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchRevoked not implemented")
+}
+func (UnimplementedSecretsServer) Introspect(context.Context, *IntrospectRequest) (*IntrospectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Introspect not implemented")
+}
+func (UnimplementedSecretsServer) List(context.Context, *ListRequest) (*SecretList, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
 }
+func (UnimplementedSecretsServer) Get(context.Context, *SecretRef) (*SecretDetails, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedSecretsServer) Watch(*WatchRequest, Secrets_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedSecretsServer) ListVersions(context.Context, *SecretRef) (*SecretVersionList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListVersions not implemented")
+}
+func (UnimplementedSecretsServer) Rollback(context.Context, *RollbackRequest) (*SecretDetails, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rollback not implemented")
+}
+func (UnimplementedSecretsServer) GetJWKS(context.Context, *Empty) (*JWKS, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJWKS not implemented")
+}
 func (UnimplementedSecretsServer) mustEmbedUnimplementedSecretsServer() {}
 
 // UnsafeSecretsServer may be embedded to opt out of forward compatibility for this service.
@@ -182,11 +516,176 @@ func _Secrets_Delete_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Secrets_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+func _Secrets_BatchCreate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SecretsServer).BatchCreate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Secrets/BatchCreate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecretsServer).BatchCreate(ctx, req.(*BatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Secrets_BatchUpdate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SecretsServer).BatchUpdate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Secrets/BatchUpdate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecretsServer).BatchUpdate(ctx, req.(*BatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Secrets_BatchDelete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchDeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SecretsServer).BatchDelete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Secrets/BatchDelete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecretsServer).BatchDelete(ctx, req.(*BatchDeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Secrets_Renew_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SecretsServer).Renew(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Secrets/Renew",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecretsServer).Renew(ctx, req.(*RenewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Secrets_RenewAll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenewAllRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SecretsServer).RenewAll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Secrets/RenewAll",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecretsServer).RenewAll(ctx, req.(*RenewAllRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Secrets_Revoke_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SecretsServer).Revoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Secrets/Revoke",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecretsServer).Revoke(ctx, req.(*RevokeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Secrets_ListRevoked_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(Empty)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
+	if interceptor == nil {
+		return srv.(SecretsServer).ListRevoked(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Secrets/ListRevoked",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecretsServer).ListRevoked(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Secrets_WatchRevoked_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SecretsServer).WatchRevoked(m, &secretsWatchRevokedServer{stream})
+}
+
+type Secrets_WatchRevokedServer interface {
+	Send(*RevokedToken) error
+	grpc.ServerStream
+}
+
+type secretsWatchRevokedServer struct {
+	grpc.ServerStream
+}
+
+func (x *secretsWatchRevokedServer) Send(m *RevokedToken) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Secrets_Introspect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IntrospectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SecretsServer).Introspect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Secrets/Introspect",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecretsServer).Introspect(ctx, req.(*IntrospectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Secrets_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
 	if interceptor == nil {
 		return srv.(SecretsServer).List(ctx, in)
 	}
@@ -195,7 +694,100 @@ func _Secrets_List_Handler(srv interface{}, ctx context.Context, dec func(interf
 		FullMethod: "/Secrets/List",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(SecretsServer).List(ctx, req.(*Empty))
+		return srv.(SecretsServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Secrets_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SecretRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SecretsServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Secrets/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecretsServer).Get(ctx, req.(*SecretRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Secrets_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SecretsServer).Watch(m, &secretsWatchServer{stream})
+}
+
+type Secrets_WatchServer interface {
+	Send(*SecretEvent) error
+	grpc.ServerStream
+}
+
+type secretsWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *secretsWatchServer) Send(m *SecretEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Secrets_ListVersions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SecretRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SecretsServer).ListVersions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Secrets/ListVersions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecretsServer).ListVersions(ctx, req.(*SecretRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Secrets_Rollback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RollbackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SecretsServer).Rollback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Secrets/Rollback",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecretsServer).Rollback(ctx, req.(*RollbackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Secrets_GetJWKS_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SecretsServer).GetJWKS(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Secrets/GetJWKS",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecretsServer).GetJWKS(ctx, req.(*Empty))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -219,11 +811,70 @@ var Secrets_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Delete",
 			Handler:    _Secrets_Delete_Handler,
 		},
+		{
+			MethodName: "BatchCreate",
+			Handler:    _Secrets_BatchCreate_Handler,
+		},
+		{
+			MethodName: "BatchUpdate",
+			Handler:    _Secrets_BatchUpdate_Handler,
+		},
+		{
+			MethodName: "BatchDelete",
+			Handler:    _Secrets_BatchDelete_Handler,
+		},
+		{
+			MethodName: "Renew",
+			Handler:    _Secrets_Renew_Handler,
+		},
+		{
+			MethodName: "RenewAll",
+			Handler:    _Secrets_RenewAll_Handler,
+		},
+		{
+			MethodName: "Revoke",
+			Handler:    _Secrets_Revoke_Handler,
+		},
+		{
+			MethodName: "ListRevoked",
+			Handler:    _Secrets_ListRevoked_Handler,
+		},
+		{
+			MethodName: "Introspect",
+			Handler:    _Secrets_Introspect_Handler,
+		},
 		{
 			MethodName: "List",
 			Handler:    _Secrets_List_Handler,
 		},
+		{
+			MethodName: "Get",
+			Handler:    _Secrets_Get_Handler,
+		},
+		{
+			MethodName: "ListVersions",
+			Handler:    _Secrets_ListVersions_Handler,
+		},
+		{
+			MethodName: "Rollback",
+			Handler:    _Secrets_Rollback_Handler,
+		},
+		{
+			MethodName: "GetJWKS",
+			Handler:    _Secrets_GetJWKS_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchRevoked",
+			Handler:       _Secrets_WatchRevoked_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _Secrets_Watch_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "infra.proto",
 }
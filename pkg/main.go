@@ -1,14 +1,25 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Taluu/challenge-jwt/generated/infrapb"
 	"github.com/Taluu/challenge-jwt/pkg/secrets"
 	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 func main() {
@@ -45,14 +56,319 @@ func main() {
 		}
 	}
 
+	if minTTL, ok := os.LookupEnv("SECRETS_MIN_TTL"); ok {
+		config.MinTTL, err = time.ParseDuration(minTTL)
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if maxTTL, ok := os.LookupEnv("SECRETS_MAX_TTL"); ok {
+		config.MaxTTL, err = time.ParseDuration(maxTTL)
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if maxRenewBefore, ok := os.LookupEnv("SECRETS_MAX_RENEW_BEFORE"); ok {
+		config.MaxRenewBefore, err = time.ParseDuration(maxRenewBefore)
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if batchSize, ok := os.LookupEnv("SECRETS_RENEW_BATCH_SIZE"); ok {
+		config.RenewBatchSize, err = strconv.Atoi(batchSize)
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if historySize, ok := os.LookupEnv("SECRETS_HISTORY_SIZE"); ok {
+		config.HistorySize, err = strconv.Atoi(historySize)
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
 	if signingKey, ok := os.LookupEnv("SECRETS_JWT_SIGNING_KEY"); ok {
 		config.SigningKey = []byte(signingKey)
 	}
 
+	if algorithm, ok := os.LookupEnv("SECRETS_JWT_ALGORITHM"); ok {
+		config.Algorithm = algorithm
+	}
+
+	if privateKey, ok := os.LookupEnv("SECRETS_JWT_PRIVATE_KEY"); ok {
+		config.PrivateKey = []byte(privateKey)
+	}
+
+	if privateKeyFile, ok := os.LookupEnv("SECRETS_JWT_PRIVATE_KEY_FILE"); ok {
+		config.PrivateKey, err = os.ReadFile(privateKeyFile)
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if keyID, ok := os.LookupEnv("SECRETS_JWT_KEY_ID"); ok {
+		config.KeyID = keyID
+	}
+
+	if retiredKeys, ok := os.LookupEnv("SECRETS_JWT_RETIRED_SIGNING_KEYS"); ok {
+		config.RetiredSigningKeys, err = parseRetiredSigningKeys(retiredKeys)
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if issuer, ok := os.LookupEnv("SECRETS_JWT_ISSUER"); ok {
+		config.Issuer = issuer
+	}
+
+	if audience, ok := os.LookupEnv("SECRETS_JWT_AUDIENCE"); ok {
+		config.Audience = strings.Split(audience, ",")
+	}
+
+	if schemaFile, ok := os.LookupEnv("SECRETS_CLAIMS_SCHEMA_FILE"); ok {
+		schema, err := os.ReadFile(schemaFile)
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		config.ClaimsSchema, err = secrets.ParseClaimsSchema(schema)
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if reservedClaims, ok := os.LookupEnv("SECRETS_RESERVED_CLAIMS"); ok {
+		config.ReservedClaims = strings.Split(reservedClaims, ",")
+	}
+
+	if keysDir, ok := os.LookupEnv("SECRETS_JWT_KEYS_DIR"); ok {
+		config.Keyring, err = loadKeyring(keysDir, os.Getenv("SECRETS_JWT_ACTIVE_KEY_ID"))
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if namespacesFile, ok := os.LookupEnv("SECRETS_NAMESPACES_FILE"); ok {
+		config.Namespaces, err = loadNamespaces(namespacesFile)
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	storeDSN := "memory://"
+
+	if dsn, ok := os.LookupEnv("SECRETS_STORE"); ok {
+		storeDSN = dsn
+	}
+
+	// the syncer would take the Kubernetes Secrets of the store for its own
+	if namespace, ok := os.LookupEnv("SECRETS_KUBERNETES_SYNC_NAMESPACE"); ok {
+		if storeURL, err := url.Parse(storeDSN); err == nil && storeURL.Scheme == "kubernetes" && storeURL.Host == namespace {
+			log.Fatalf("SECRETS_KUBERNETES_SYNC_NAMESPACE can't be \"%s\", the namespace of the kubernetes store", namespace)
+		}
+	}
+
+	store, err := openSecretStore(context.Background(), storeDSN)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	service, err := secrets.NewService(store, config)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if jwksAddr, ok := os.LookupEnv("SECRETS_JWKS_ADDR"); ok {
+		mux := http.NewServeMux()
+		mux.Handle("/.well-known/jwks.json", service.JWKSHandler())
+
+		go func() {
+			log.Fatalln(http.ListenAndServe(jwksAddr, mux))
+		}()
+	}
+
+	if namespace, ok := os.LookupEnv("SECRETS_KUBERNETES_SYNC_NAMESPACE"); ok {
+		syncConfig := secrets.KubernetesSyncConfig{
+			Namespace:  namespace,
+			NamePrefix: os.Getenv("SECRETS_KUBERNETES_SYNC_NAME_PREFIX"),
+			DataKey:    os.Getenv("SECRETS_KUBERNETES_SYNC_DATA_KEY"),
+		}
+
+		if syncLabels, ok := os.LookupEnv("SECRETS_KUBERNETES_SYNC_LABELS"); ok {
+			syncConfig.Labels, err = labels.ConvertSelectorToLabelsMap(syncLabels)
+
+			if err != nil {
+				log.Fatalln(err)
+			}
+		}
+
+		client, err := newKubernetesClient()
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		go secrets.NewKubernetesSyncer(client, syncConfig).Run(context.Background(), service)
+	}
+
 	server := grpc.NewServer()
-	service := secrets.NewService(secrets.NewSecretStore(), config)
 
 	infrapb.RegisterSecretsServer(server, service)
 
 	log.Fatalln(server.Serve(listener))
 }
+
+// parseRetiredSigningKeys parses the retired HMAC keys, given as "<key id>=<shared secret>" pairs
+// separated by commas. A key given without ID gets the ID derived from its secret.
+func parseRetiredSigningKeys(value string) ([]secrets.RetiredSigningKey, error) {
+	var keys []secrets.RetiredSigningKey
+	ids := make(map[string]bool)
+
+	for _, pair := range strings.Split(value, ",") {
+		id, secret, ok := strings.Cut(pair, "=")
+
+		if !ok {
+			return nil, fmt.Errorf("retired signing key \"%s\" should be given as <key id>=<shared secret>", id)
+		}
+
+		if id == "" {
+			id = secrets.SecretKeyID([]byte(secret))
+		}
+
+		if ids[id] {
+			return nil, fmt.Errorf("retired signing key ID \"%s\" is given more than once", id)
+		}
+
+		ids[id] = true
+		keys = append(keys, secrets.RetiredSigningKey{ID: id, Secret: []byte(secret)})
+	}
+
+	return keys, nil
+}
+
+// loadKeyring loads every "<key id>.pem" private key in dir. The key with the activeKeyID ID signs
+// the new tokens, while the other ones are only used to verify the tokens they signed.
+func loadKeyring(dir string, activeKeyID string) (*secrets.Keyring, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		active  *secrets.SigningKey
+		retired []secrets.SigningKey
+	)
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := secrets.NewSigningKeyFromPEM(content)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s : %w", file, err)
+		}
+
+		key.ID = strings.TrimSuffix(filepath.Base(file), ".pem")
+
+		if key.ID == activeKeyID {
+			active = &key
+			continue
+		}
+
+		retired = append(retired, key)
+	}
+
+	if active == nil {
+		return nil, fmt.Errorf("active key \"%s\" not found in %s", activeKeyID, dir)
+	}
+
+	return secrets.NewKeyring(*active, retired...)
+}
+
+// namespaceFile is the configuration of a namespace in the SECRETS_NAMESPACES_FILE file.
+type namespaceFile struct {
+	TTL            string   `json:"ttl"`
+	Issuer         string   `json:"issuer"`
+	Audience       []string `json:"audience"`
+	Algorithm      string   `json:"algorithm"`
+	SigningKey     string   `json:"signing_key"`
+	PrivateKeyFile string   `json:"private_key_file"`
+	KeyID          string   `json:"key_id"`
+}
+
+// loadNamespaces loads the configuration of the namespaces from a JSON file, mapping each
+// namespace to its settings.
+func loadNamespaces(file string) (map[string]secrets.NamespaceConfig, error) {
+	content, err := os.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaceFiles map[string]namespaceFile
+
+	if err := json.Unmarshal(content, &namespaceFiles); err != nil {
+		return nil, fmt.Errorf("%s : %w", file, err)
+	}
+
+	namespaces := make(map[string]secrets.NamespaceConfig, len(namespaceFiles))
+
+	for name, namespace := range namespaceFiles {
+		config := secrets.NamespaceConfig{
+			Issuer:     namespace.Issuer,
+			Audience:   namespace.Audience,
+			Algorithm:  namespace.Algorithm,
+			SigningKey: []byte(namespace.SigningKey),
+			KeyID:      namespace.KeyID,
+		}
+
+		if namespace.TTL != "" {
+			if config.TTL, err = time.ParseDuration(namespace.TTL); err != nil {
+				return nil, fmt.Errorf("namespace \"%s\" : %w", name, err)
+			}
+		}
+
+		if namespace.PrivateKeyFile != "" {
+			if config.PrivateKey, err = os.ReadFile(namespace.PrivateKeyFile); err != nil {
+				return nil, fmt.Errorf("namespace \"%s\" : %w", name, err)
+			}
+		}
+
+		namespaces[name] = config
+	}
+
+	return namespaces, nil
+}
+
+// newKubernetesClient creates a client for the cluster the service is running in.
+func newKubernetesClient() (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return kubernetes.NewForConfig(config)
+}
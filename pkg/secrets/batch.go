@@ -0,0 +1,344 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxBatchSize is the maximum number of items of a batch RPC.
+const maxBatchSize = 1000
+
+// batchItem is an item of a batch RPC : the secret it creates, updates or deletes, and why it
+// failed, if it did.
+type batchItem struct {
+	namespace string
+	name      string
+	secret    Secret
+	err       error
+
+	// current is the stored secret an update is applied to, and update is the change to apply.
+	current Secret
+	update  func(*Secret) error
+
+	// exists tells whether a deleted secret was found.
+	exists bool
+}
+
+func (s *Service) BatchCreate(ctx context.Context, in *infrapb.BatchRequest) (*infrapb.BatchResponse, error) {
+	items := make([]batchItem, len(in.Secrets))
+
+	for i, secret := range in.Secrets {
+		items[i] = batchItem{namespace: secret.Namespace, name: secret.Name}
+	}
+
+	if err := checkBatch(items); err != nil {
+		return &infrapb.BatchResponse{}, err
+	}
+
+	for i, secret := range in.Secrets {
+		if items[i].err == nil {
+			items[i].secret, items[i].err = s.createdSecret(ctx, secret)
+		}
+	}
+
+	store, atomic := s.store.(BatchStore)
+
+	switch {
+	case !validBatch(items):
+		abortBatch(items)
+
+	case atomic:
+		err := store.CreateAll(ctx, batchSecrets(items))
+
+		if errors.Is(err, ErrSecretExists) {
+			s.existingBatch(ctx, items)
+		} else if err != nil {
+			failBatch(items, status.Errorf(codes.Internal, "couldn't create secrets : %s", err))
+		}
+
+	default:
+		for i := range items {
+			items[i].err = createStatus(items[i].name, s.store.Create(ctx, items[i].secret))
+		}
+	}
+
+	return s.batchResponse(items, atomic, SecretCreated), nil
+}
+
+func (s *Service) BatchUpdate(ctx context.Context, in *infrapb.BatchRequest) (*infrapb.BatchResponse, error) {
+	items := make([]batchItem, len(in.Secrets))
+
+	for i, secret := range in.Secrets {
+		items[i] = batchItem{namespace: secret.Namespace, name: secret.Name}
+	}
+
+	if err := checkBatch(items); err != nil {
+		return &infrapb.BatchResponse{}, err
+	}
+
+	for i, secret := range in.Secrets {
+		if items[i].err == nil {
+			items[i].err = s.prepareBatchUpdate(ctx, &items[i], secret)
+		}
+	}
+
+	store, atomic := s.store.(BatchStore)
+
+	switch {
+	case !validBatch(items):
+		abortBatch(items)
+
+	case atomic:
+		s.updateBatch(ctx, store, items)
+
+	default:
+		for i := range items {
+			secret, err := s.updateSecret(ctx, items[i].current, items[i].update)
+
+			if err != nil {
+				items[i].err = updateStatus(items[i].name, err)
+			}
+
+			items[i].secret = secret
+		}
+	}
+
+	return s.batchResponse(items, atomic, SecretUpdated), nil
+}
+
+// prepareBatchUpdate fetches the secret updated by an item, and applies the update to a copy of
+// it, so that the resulting claims are checked before any item is applied.
+func (s *Service) prepareBatchUpdate(ctx context.Context, item *batchItem, in *infrapb.Secret) error {
+	current, err := s.store.Fetch(ctx, in.Namespace, in.Name)
+
+	if errors.Is(err, ErrSecretNotFound) {
+		return status.Errorf(codes.NotFound, "secret name \"%s\" doesn't exists", in.Name)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "couldn't fetch secret : %s", err)
+	}
+
+	update, err := s.secretUpdate(ctx, in, current)
+
+	if err != nil {
+		return err
+	}
+
+	item.current = current
+	item.update = update
+	item.secret = current.clone()
+
+	if err := update(&item.secret); err != nil {
+		return updateStatus(in.Name, err)
+	}
+
+	return nil
+}
+
+// updateBatch saves the updated secrets all at once. If any of them was modified in the meantime,
+// every secret is fetched again and updated, up to maxConflictRetries times.
+func (s *Service) updateBatch(ctx context.Context, store BatchStore, items []batchItem) {
+	for attempt := 0; ; attempt++ {
+		err := store.SaveAll(ctx, batchSecrets(items))
+
+		if err == nil {
+			for i := range items {
+				items[i].secret.Revision++
+			}
+
+			return
+		}
+
+		if !errors.Is(err, ErrSecretConflict) || attempt == maxConflictRetries {
+			for i := range items {
+				items[i].err = updateStatus(items[i].name, err)
+			}
+
+			return
+		}
+
+		for i := range items {
+			secret, err := s.store.Fetch(ctx, items[i].namespace, items[i].name)
+
+			if err == nil {
+				err = items[i].update(&secret)
+			}
+
+			if err != nil {
+				items[i].err = updateStatus(items[i].name, err)
+				abortBatch(items)
+
+				return
+			}
+
+			items[i].secret = secret
+		}
+	}
+}
+
+func (s *Service) BatchDelete(ctx context.Context, in *infrapb.BatchDeleteRequest) (*infrapb.BatchResponse, error) {
+	items := make([]batchItem, len(in.Secrets))
+
+	for i, ref := range in.Secrets {
+		items[i] = batchItem{namespace: ref.Namespace, name: ref.Name}
+	}
+
+	if err := checkBatch(items); err != nil {
+		return &infrapb.BatchResponse{}, err
+	}
+
+	for i := range items {
+		if items[i].err != nil {
+			continue
+		}
+
+		if err := checkNamespace(items[i].namespace); err != nil {
+			items[i].err = status.Errorf(codes.InvalidArgument, "invalid namespace : %s", err)
+
+			continue
+		}
+
+		// the deleted secrets are fetched for their events, as for Delete
+		secret, err := s.store.Fetch(ctx, items[i].namespace, items[i].name)
+		items[i].secret = secret
+		items[i].exists = err == nil
+	}
+
+	store, atomic := s.store.(BatchStore)
+
+	switch {
+	case !validBatch(items):
+		abortBatch(items)
+
+	case atomic:
+		secrets := make([]Secret, len(items))
+
+		for i, item := range items {
+			secrets[i] = Secret{Namespace: item.namespace, Name: item.name}
+		}
+
+		if err := store.DeleteAll(ctx, secrets); err != nil {
+			failBatch(items, status.Errorf(codes.Internal, "couldn't delete secrets : %s", err))
+		}
+
+	default:
+		for i := range items {
+			if err := s.store.Delete(ctx, items[i].namespace, items[i].name); err != nil {
+				items[i].err = status.Errorf(codes.Internal, "couldn't delete secret : %s", err)
+			}
+		}
+	}
+
+	for _, item := range items {
+		if item.err == nil {
+			s.renewBackoff.forget(item.namespace, item.name)
+		}
+	}
+
+	return s.batchResponse(items, atomic, SecretDeleted), nil
+}
+
+// checkBatch checks the size of a batch, and that each secret is given only once, the items
+// giving a secret again being invalid.
+func checkBatch(items []batchItem) error {
+	if len(items) > maxBatchSize {
+		return status.Errorf(codes.InvalidArgument, "a batch has at most %d items, got %d", maxBatchSize, len(items))
+	}
+
+	given := make(map[string]bool, len(items))
+
+	for i, item := range items {
+		key := namespacedKey(item.namespace, item.name)
+
+		if given[key] {
+			items[i].err = status.Errorf(codes.InvalidArgument, "secret name \"%s\" is given more than once", item.name)
+		}
+
+		given[key] = true
+	}
+
+	return nil
+}
+
+// validBatch tells whether every item of the batch is valid.
+func validBatch(items []batchItem) bool {
+	for _, item := range items {
+		if item.err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// abortBatch fails the items which are still valid, as another item of the batch failed.
+func abortBatch(items []batchItem) {
+	for i := range items {
+		if items[i].err == nil {
+			items[i].err = status.Error(codes.Aborted, "not applied, as another item of the batch failed")
+		}
+	}
+}
+
+// existingBatch fails the items whose secret was created since they were checked, the other ones
+// being aborted.
+func (s *Service) existingBatch(ctx context.Context, items []batchItem) {
+	for i, item := range items {
+		if contains, _ := s.store.Contains(ctx, item.namespace, item.name); contains {
+			items[i].err = createStatus(item.name, ErrSecretExists)
+		}
+	}
+
+	abortBatch(items)
+}
+
+// failBatch fails every item of a batch which failed to be applied atomically.
+func failBatch(items []batchItem, err error) {
+	for i := range items {
+		items[i].err = err
+	}
+}
+
+func batchSecrets(items []batchItem) []Secret {
+	secrets := make([]Secret, len(items))
+
+	for i, item := range items {
+		secrets[i] = item.secret
+	}
+
+	return secrets
+}
+
+// batchResponse publishes the events of the applied items, and returns the result of every item.
+func (s *Service) batchResponse(items []batchItem, atomic bool, eventType SecretEventType) *infrapb.BatchResponse {
+	results := make([]*infrapb.BatchResult, len(items))
+
+	for i, item := range items {
+		result := &infrapb.BatchResult{Namespace: item.namespace, Name: item.name}
+
+		switch {
+		case item.err != nil:
+			st := status.Convert(item.err)
+			result.Code = int32(st.Code())
+			result.Error = st.Message()
+
+		case eventType == SecretDeleted:
+			if item.exists {
+				s.events.publish(eventType, item.secret)
+			}
+
+		default:
+			s.events.publish(eventType, item.secret)
+			result.Secret = newSecret(item.secret)
+		}
+
+		results[i] = result
+	}
+
+	return &infrapb.BatchResponse{Results: results, Atomic: atomic}
+}
@@ -0,0 +1,242 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// failingStore doesn't support transactions, and fails to save the secrets whose name starts with
+// failing.
+type failingStore struct {
+	SecretStore
+	failing string
+}
+
+func (s failingStore) Save(ctx context.Context, in Secret) error {
+	if strings.HasPrefix(in.Name, s.failing) {
+		return errors.New("failing store")
+	}
+
+	return s.SecretStore.Save(ctx, in)
+}
+
+func (s failingStore) Create(ctx context.Context, in Secret) error {
+	if strings.HasPrefix(in.Name, s.failing) {
+		return errors.New("failing store")
+	}
+
+	return s.SecretStore.Create(ctx, in)
+}
+
+// racingStore creates its racing secret right before creating the given secrets, as if it was
+// created concurrently once they were checked.
+type racingStore struct {
+	*secretStore
+	racing Secret
+}
+
+func (s racingStore) Create(ctx context.Context, in Secret) error {
+	return s.CreateAll(ctx, []Secret{in})
+}
+
+func (s racingStore) CreateAll(ctx context.Context, secrets []Secret) error {
+	s.secretStore.Create(ctx, s.racing)
+
+	return s.secretStore.CreateAll(ctx, secrets)
+}
+
+// batchCodes returns the status code of each item of a batch.
+func batchCodes(res *infrapb.BatchResponse) []codes.Code {
+	result := make([]codes.Code, len(res.Results))
+
+	for i, item := range res.Results {
+		result[i] = codes.Code(item.Code)
+	}
+
+	return result
+}
+
+func TestBatch(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+
+	expectCodes := func(t *testing.T, res *infrapb.BatchResponse, err error, expected ...codes.Code) {
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if !reflect.DeepEqual(batchCodes(res), expected) {
+			t.Fatalf("Expected %v, got %v", expected, res.Results)
+		}
+	}
+
+	t.Run("create", func(t *testing.T) {
+		res, err := client.BatchCreate(ctx, &infrapb.BatchRequest{Secrets: []*infrapb.Secret{
+			{Name: "eu-1", Claims: map[string]string{"region": "eu"}},
+			{Name: "eu-2", Claims: map[string]string{"region": "eu"}},
+			{Namespace: "game", Name: "eu-1"},
+		}})
+
+		expectCodes(t, res, err, codes.OK, codes.OK, codes.OK)
+
+		if !res.Atomic || res.Results[0].Secret.Claims["region"] != "eu" {
+			t.Fatalf("Expected the secrets to be created atomically, got %v", res)
+		}
+
+		if contains, _ := store.Contains(ctx, "game", "eu-1"); !contains {
+			t.Fatal("Expected the secret to be created")
+		}
+	})
+
+	t.Run("invalid items", func(t *testing.T) {
+		res, err := client.BatchCreate(ctx, &infrapb.BatchRequest{Secrets: []*infrapb.Secret{
+			{Name: "us-1"},
+			{Name: "us-2", Claims: map[string]string{"id": "forged"}},
+			{Name: "us-1"},
+			{Name: "eu-1"},
+		}})
+
+		expectCodes(t, res, err, codes.Aborted, codes.InvalidArgument, codes.InvalidArgument, codes.AlreadyExists)
+
+		if contains, _ := store.Contains(ctx, "", "us-1"); contains {
+			t.Fatal("Expected no secret to be created")
+		}
+
+		tooLarge := make([]*infrapb.Secret, maxBatchSize+1)
+
+		for i := range tooLarge {
+			tooLarge[i] = &infrapb.Secret{Name: fmt.Sprintf("s-%d", i)}
+		}
+
+		if _, err := client.BatchCreate(ctx, &infrapb.BatchRequest{Secrets: tooLarge}); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected an invalid argument error, got %v", err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		res, err := client.BatchUpdate(ctx, &infrapb.BatchRequest{Secrets: []*infrapb.Secret{
+			{Name: "eu-1", Claims: map[string]string{"tier": "2"}},
+			{Name: "eu-2", RemoveClaims: []string{"region"}},
+		}})
+
+		expectCodes(t, res, err, codes.OK, codes.OK)
+
+		if claims := res.Results[0].Secret.Claims; claims["region"] != "eu" || claims["tier"] != "2" {
+			t.Fatalf("Expected the merged claims, got %v", claims)
+		}
+
+		if secret, _ := store.Fetch(ctx, "", "eu-2"); secret.Claims["region"] != nil {
+			t.Fatalf("Expected the claim to be removed, got %v", secret.Claims)
+		}
+
+		res, err = client.BatchUpdate(ctx, &infrapb.BatchRequest{Secrets: []*infrapb.Secret{
+			{Name: "eu-1", Claims: map[string]string{"tier": "3"}},
+			{Name: "not existing"},
+		}})
+
+		expectCodes(t, res, err, codes.Aborted, codes.NotFound)
+
+		if secret, _ := store.Fetch(ctx, "", "eu-1"); secret.Claims["tier"] != "2" {
+			t.Fatalf("Expected the secret not to be updated, got %v", secret.Claims)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		res, err := client.BatchDelete(ctx, &infrapb.BatchDeleteRequest{Secrets: []*infrapb.SecretRef{
+			{Name: "eu-1"},
+			{Namespace: "game", Name: "eu-1"},
+			{Name: "not existing"},
+		}})
+
+		expectCodes(t, res, err, codes.OK, codes.OK, codes.OK)
+
+		if list, _ := store.List(ctx, ListOptions{AllNamespaces: true}); len(list) != 1 || list[0].Name != "eu-2" {
+			t.Fatalf("Expected only eu-2 to be left, got %v", list)
+		}
+	})
+}
+
+func TestBatchWithoutTransactions(t *testing.T) {
+	store := failingStore{SecretStore: NewSecretStore(), failing: "failing"}
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+
+	res, err := client.BatchCreate(ctx, &infrapb.BatchRequest{Secrets: []*infrapb.Secret{
+		{Name: "foo"},
+		{Name: "failing"},
+		{Name: "bar"},
+	}})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if res.Atomic {
+		t.Fatal("Expected the batch not to be applied atomically")
+	}
+
+	if got := batchCodes(res); got[0] != codes.OK || got[1] != codes.Internal || got[2] != codes.OK {
+		t.Fatalf("Expected only the failing item to fail, got %v", res.Results)
+	}
+
+	for _, name := range []string{"foo", "bar"} {
+		if contains, _ := store.Contains(ctx, "", name); !contains {
+			t.Fatalf("Expected secret \"%s\" to be created", name)
+		}
+	}
+}
+
+func TestBatchCreateRace(t *testing.T) {
+	racing := NewSecret("eu-2", time.Hour)
+	store := racingStore{secretStore: NewSecretStore().(*secretStore), racing: racing}
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+
+	res, err := client.BatchCreate(ctx, &infrapb.BatchRequest{Secrets: []*infrapb.Secret{
+		{Name: "eu-1"},
+		{Name: "eu-2"},
+	}})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if got := batchCodes(res); got[0] != codes.Aborted || got[1] != codes.AlreadyExists {
+		t.Fatalf("Expected the concurrently created item to already exist, got %v", res.Results)
+	}
+
+	if secret, _ := store.Fetch(ctx, "", "eu-2"); secret.Token != racing.Token {
+		t.Fatal("The concurrently created secret should not be overwritten")
+	}
+}
@@ -0,0 +1,151 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// claimsFromProto merges the string claims and the typed claims of a request. The string claims
+// are kept as strings, so that the clients only knowing them get the same tokens as before.
+func claimsFromProto(claims map[string]string, typedClaims *structpb.Struct) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(claims)+len(typedClaims.GetFields()))
+
+	for k, v := range claims {
+		result[k] = v
+	}
+
+	for k, v := range typedClaims.AsMap() {
+		if _, ok := result[k]; ok {
+			return nil, fmt.Errorf("claim \"%s\" is given both as a string and as a typed claim", k)
+		}
+
+		result[k] = v
+	}
+
+	return result, nil
+}
+
+// claimsToProto returns the claims both as strings, the ones which are not being JSON encoded, and
+// typed.
+func claimsToProto(claims map[string]interface{}) (map[string]string, *structpb.Struct) {
+	stringClaims := make(map[string]string, len(claims))
+
+	for k, v := range claims {
+		if s, ok := v.(string); ok {
+			stringClaims[k] = s
+			continue
+		}
+
+		encoded, _ := json.Marshal(v)
+		stringClaims[k] = string(encoded)
+	}
+
+	// the claims are decoded from JSON or from a Struct, so they can always be converted
+	typedClaims, _ := structpb.NewStruct(claims)
+
+	return stringClaims, typedClaims
+}
+
+// claimTime reads a date claim, a unix timestamp which is either a number or, for the claims given
+// as strings, a numeric string.
+func claimTime(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	var unix int64
+
+	switch v := claims[name].(type) {
+	case nil:
+		if _, ok := claims[name]; !ok {
+			return time.Time{}, false, nil
+		}
+
+		return time.Time{}, true, fmt.Errorf("claim \"%s\" is null", name)
+
+	case string:
+		parsed, err := strconv.ParseInt(v, 10, 64)
+
+		if err != nil {
+			return time.Time{}, true, err
+		}
+
+		unix = parsed
+
+	case float64:
+		unix = int64(v)
+
+	case int64:
+		unix = v
+
+	case int:
+		unix = int64(v)
+
+	default:
+		return time.Time{}, true, fmt.Errorf("claim \"%s\" is not a unix timestamp", name)
+	}
+
+	return time.Unix(unix, 0), true, nil
+}
+
+// checkRegisteredClaims checks the format of the registered claims (RFC 7519, section 4.1) a
+// client can give, the "iat" and "jti" ones being set by the service. The "nbf" date is converted to
+// a number as for "exp".
+func checkRegisteredClaims(claims map[string]interface{}, expiresAt time.Time) []claimViolation {
+	var violations []claimViolation
+
+	notBefore, ok, err := claimTime(claims, "nbf")
+
+	if err != nil {
+		violations = append(violations, claimViolation{"nbf", fmt.Sprintf("is not a valid date : %s", err)})
+	} else if ok {
+		if !notBefore.Before(expiresAt) {
+			violations = append(violations, claimViolation{"nbf", "should be before the expiration date"})
+		}
+
+		claims["nbf"] = notBefore.Unix()
+	}
+
+	for _, name := range []string{"sub", "iss"} {
+		if v, ok := claims[name]; ok {
+			if _, ok := v.(string); !ok {
+				violations = append(violations, claimViolation{name, "should be a string"})
+			}
+		}
+	}
+
+	if aud, ok := claims["aud"]; ok && !isAudience(aud) {
+		violations = append(violations, claimViolation{"aud", "should be a string or an array of strings"})
+	}
+
+	return violations
+}
+
+// isAudience checks that an "aud" claim is either a single audience or an array of them.
+func isAudience(aud interface{}) bool {
+	switch v := aud.(type) {
+	case string:
+		return true
+
+	case []interface{}:
+		for _, audience := range v {
+			if _, ok := audience.(string); !ok {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func copyClaims(claims map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(claims))
+
+	for k, v := range claims {
+		result[k] = v
+	}
+
+	return result
+}
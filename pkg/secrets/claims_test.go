@@ -0,0 +1,215 @@
+package secrets
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"github.com/golang-jwt/jwt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestTypedClaims(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+
+	t.Run("types are kept in the token", func(t *testing.T) {
+		typedClaims, _ := structpb.NewStruct(map[string]interface{}{
+			"tier":  2,
+			"roles": []interface{}{"admin"},
+			"beta":  true,
+		})
+
+		_, err := client.Create(ctx, &infrapb.Secret{Name: "typed", Claims: map[string]string{"Foo": "bar"}, TypedClaims: typedClaims})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		secret, _ := store.Fetch(ctx, "", "typed")
+		token, err := parseToken(secret.Token, conn.service.keyring.keyfunc)
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		claims := token.Claims.(jwt.MapClaims)
+		roles, _ := claims["roles"].([]interface{})
+
+		if claims["tier"] != float64(2) || claims["beta"] != true || len(roles) != 1 || roles[0] != "admin" || claims["Foo"] != "bar" {
+			t.Fatalf("Expected the claims to keep their types, got %v", claims)
+		}
+
+		details, err := client.Get(ctx, &infrapb.SecretRef{Name: "typed"})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if details.Claims["tier"] != "2" || details.Claims["roles"] != `["admin"]` || details.Claims["Foo"] != "bar" {
+			t.Fatalf("Expected the claims to be encoded as strings, got %v", details.Claims)
+		}
+
+		if details.TypedClaims.Fields["tier"].GetNumberValue() != 2 || details.TypedClaims.Fields["Foo"].GetStringValue() != "bar" {
+			t.Fatalf("Expected the typed claims, got %v", details.TypedClaims)
+		}
+	})
+
+	t.Run("string expiration date", func(t *testing.T) {
+		exp := time.Now().Add(time.Hour).Unix()
+
+		_, err := client.Create(ctx, &infrapb.Secret{Name: "legacy", Claims: map[string]string{"exp": fmt.Sprint(exp)}})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		secret, _ := store.Fetch(ctx, "", "legacy")
+		token, _ := parseToken(secret.Token, conn.service.keyring.keyfunc)
+
+		if token.Claims.(jwt.MapClaims)["exp"] != float64(exp) || secret.ExpiresAt.Unix() != exp {
+			t.Fatalf("Expected the expiration date to be a number, got %v", token.Claims)
+		}
+	})
+
+	t.Run("invalid claims", func(t *testing.T) {
+		tests := map[string]*infrapb.Secret{
+			"both string and typed": {
+				Name:        "both",
+				Claims:      map[string]string{"Foo": "bar"},
+				TypedClaims: &structpb.Struct{Fields: map[string]*structpb.Value{"Foo": structpb.NewStringValue("baz")}},
+			},
+			"typed expiration date": {
+				Name:        "exp",
+				TypedClaims: &structpb.Struct{Fields: map[string]*structpb.Value{"exp": structpb.NewBoolValue(true)}},
+			},
+		}
+
+		for name, secret := range tests {
+			t.Run(name, func(t *testing.T) {
+				_, err := client.Create(ctx, secret)
+
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expected an invalid argument error, got %v", err)
+				}
+			})
+		}
+	})
+}
+
+func TestRegisteredClaims(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnectionWithConfig(t, store, Config{SigningKey: []byte(testSigningKey), Issuer: "secrets", Audience: []string{"backend"}})
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+	notBefore := time.Now().Add(-time.Minute).Unix()
+
+	_, err := client.Create(ctx, &infrapb.Secret{
+		Name:   "foo",
+		Claims: map[string]string{"sub": "game-server", "nbf": fmt.Sprint(notBefore)},
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	tokenClaims := func() jwt.MapClaims {
+		secret, _ := store.Fetch(ctx, "", "foo")
+		token, err := parseToken(secret.Token, conn.service.keyring.keyfunc)
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		return token.Claims.(jwt.MapClaims)
+	}
+
+	created := tokenClaims()
+
+	if created["iss"] != "secrets" || created["aud"] != "backend" || created["sub"] != "game-server" || created["nbf"] != float64(notBefore) {
+		t.Fatalf("Expected the registered claims to be set, got %v", created)
+	}
+
+	if _, ok := created["iat"].(float64); !ok || created["jti"] == "" {
+		t.Fatalf("Expected the token to have an issue date and an id, got %v", created)
+	}
+
+	if _, err := client.Renew(ctx, &infrapb.RenewRequest{Name: "foo"}); err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	renewed := tokenClaims()
+
+	if renewed["jti"] == created["jti"] || renewed["iss"] != "secrets" || renewed["sub"] != "game-server" || renewed["nbf"] != created["nbf"] {
+		t.Fatalf("Expected a new token with the same registered claims, got %v", renewed)
+	}
+
+	t.Run("renew a token not valid yet", func(t *testing.T) {
+		notBefore := time.Now().Add(time.Hour).Unix()
+
+		_, err := client.Create(ctx, &infrapb.Secret{Name: "later", Claims: map[string]string{"nbf": fmt.Sprint(notBefore)}})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if _, err := client.Renew(ctx, &infrapb.RenewRequest{Name: "later"}); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		before, _ := store.Fetch(ctx, "", "later")
+		conn.service.renewExpiredSecrets(ctx, conn.service.keyring, 2*defaultTTL, defaultTTL)
+
+		if after, _ := store.Fetch(ctx, "", "later"); after.Token == before.Token {
+			t.Fatal("Expected the background renewer to renew a token not valid yet")
+		}
+	})
+
+	tests := map[string]*infrapb.Secret{
+		"not a string subject": {
+			Name:        "sub",
+			TypedClaims: &structpb.Struct{Fields: map[string]*structpb.Value{"sub": structpb.NewNumberValue(42)}},
+		},
+		"not a list of audiences": {
+			Name: "aud",
+			TypedClaims: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"aud": structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{structpb.NewNumberValue(42)}}),
+			}},
+		},
+		"configured issuer": {
+			Name:   "iss",
+			Claims: map[string]string{"iss": "someone else"},
+		},
+		"not before the expiration date": {
+			Name:   "nbf",
+			Claims: map[string]string{"exp": fmt.Sprint(notBefore), "nbf": fmt.Sprint(notBefore + 60)},
+		},
+	}
+
+	for name, secret := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := client.Create(ctx, secret)
+
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Expected an invalid argument error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultEventHistory    = 1000
+	subscriptionBufferSize = 64
+)
+
+type SecretEventType int
+
+const (
+	SecretCreated SecretEventType = iota + 1
+	SecretUpdated
+	SecretRenewed
+	SecretDeleted
+)
+
+var (
+	// ErrRevisionCompacted is returned when subscribing from a revision which is not kept anymore.
+	ErrRevisionCompacted = errors.New("revision is not available anymore")
+
+	// ErrRevisionInFuture is returned when subscribing from a revision which is not reached yet,
+	// which is what a client sees once the service restarted, as the revisions start over.
+	ErrRevisionInFuture = errors.New("revision is in the future")
+
+	// ErrSubscriptionOverflow is returned when a subscriber doesn't consume its events fast enough.
+	ErrSubscriptionOverflow = errors.New("subscriber is too slow to consume the events")
+)
+
+// SecretEvent describes a change made to a secret. Revisions are incremented on each change.
+type SecretEvent struct {
+	Type     SecretEventType
+	Revision uint64
+	Secret   Secret
+}
+
+// eventBroker dispatches the changes made to the secrets to its subscribers, keeping the last
+// events so that subscribers can resume from a previous revision.
+type eventBroker struct {
+	lock        sync.Mutex
+	revision    uint64
+	history     []SecretEvent
+	size        int
+	subscribers map[*Subscription]struct{}
+}
+
+func newEventBroker(size int) *eventBroker {
+	return &eventBroker{
+		history:     make([]SecretEvent, 0, size),
+		size:        size,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+func (b *eventBroker) publish(eventType SecretEventType, secret Secret) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.revision++
+
+	// the secret is copied, as it may be modified once the event is sent
+	secret = secret.clone()
+
+	event := SecretEvent{
+		Type:     eventType,
+		Revision: b.revision,
+		Secret:   secret,
+	}
+
+	if len(b.history) == b.size {
+		copy(b.history, b.history[1:])
+		b.history = b.history[:b.size-1]
+	}
+
+	b.history = append(b.history, event)
+
+	for subscription := range b.subscribers {
+		select {
+		case subscription.events <- event:
+		default:
+			b.unsubscribe(subscription, ErrSubscriptionOverflow)
+		}
+	}
+}
+
+// subscribe registers a new subscriber. If fromRevision is not 0, the events that happened after
+// it are sent first.
+func (b *eventBroker) subscribe(fromRevision uint64) (*Subscription, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if fromRevision > b.revision {
+		return nil, fmt.Errorf("%w (current revision is %d)", ErrRevisionInFuture, b.revision)
+	}
+
+	var backlog []SecretEvent
+
+	if fromRevision > 0 && fromRevision < b.revision {
+		if len(b.history) == 0 || b.history[0].Revision > fromRevision+1 {
+			return nil, ErrRevisionCompacted
+		}
+
+		backlog = b.history[fromRevision+1-b.history[0].Revision:]
+	}
+
+	subscription := &Subscription{
+		broker: b,
+		events: make(chan SecretEvent, len(backlog)+subscriptionBufferSize),
+	}
+
+	for _, event := range backlog {
+		subscription.events <- event
+	}
+
+	b.subscribers[subscription] = struct{}{}
+
+	return subscription, nil
+}
+
+func (b *eventBroker) unsubscribe(subscription *Subscription, err error) {
+	if _, ok := b.subscribers[subscription]; !ok {
+		return
+	}
+
+	delete(b.subscribers, subscription)
+
+	subscription.err = err
+	close(subscription.events)
+}
+
+// Subscription receives the changes made to the secrets, until it's closed.
+type Subscription struct {
+	broker *eventBroker
+	events chan SecretEvent
+	err    error
+}
+
+// Events returns the channel on which the events are sent. It's closed when the subscription is,
+// after which Err tells why.
+func (s *Subscription) Events() <-chan SecretEvent {
+	return s.events
+}
+
+// Err returns the reason the subscription was closed by the service, if any.
+func (s *Subscription) Err() error {
+	s.broker.lock.Lock()
+	defer s.broker.lock.Unlock()
+
+	return s.err
+}
+
+// Close stops receiving events.
+func (s *Subscription) Close() {
+	s.broker.lock.Lock()
+	defer s.broker.lock.Unlock()
+
+	s.broker.unsubscribe(s, nil)
+}
+
+// Subscribe allows to receive the changes made to the secrets. If fromRevision is not 0, the
+// events that happened after it are sent first.
+func (s *Service) Subscribe(fromRevision uint64) (*Subscription, error) {
+	return s.events.subscribe(fromRevision)
+}
+
+func (s *Service) Watch(in *infrapb.WatchRequest, stream infrapb.Secrets_WatchServer) error {
+	subscription, err := s.events.subscribe(in.FromRevision)
+
+	// in both cases, the client has to list the secrets again before watching
+	if errors.Is(err, ErrRevisionCompacted) || errors.Is(err, ErrRevisionInFuture) {
+		return status.Errorf(codes.OutOfRange, "couldn't watch from revision %d : %s", in.FromRevision, err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "couldn't watch from revision %d : %s", in.FromRevision, err)
+	}
+
+	defer subscription.Close()
+
+	options := ListOptions{Namespace: in.Namespace, AllNamespaces: in.AllNamespaces}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return status.Errorf(codes.ResourceExhausted, "watch interrupted : %s", subscription.Err())
+			}
+
+			// the revisions are shared by every namespace, so some of them are skipped
+			if !options.matches(event.Secret) {
+				continue
+			}
+
+			err := stream.Send(&infrapb.SecretEvent{
+				Type:     infrapb.SecretEvent_Type(event.Type),
+				Revision: event.Revision,
+				Secret:   newSecretDetails(event.Secret),
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
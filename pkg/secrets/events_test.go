@@ -0,0 +1,168 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWatch(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+
+	if _, err := client.Create(ctx, &infrapb.Secret{Name: "watched"}); err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	stream, err := client.Watch(ctx, &infrapb.WatchRequest{FromRevision: 1})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	conn.service.renewExpiredSecrets(ctx, conn.service.keyring, 2*defaultTTL, defaultTTL)
+
+	client.Update(ctx, &infrapb.Secret{Name: "watched", Claims: map[string]string{"Foo": "bar"}})
+	client.Delete(ctx, &infrapb.Secret{Name: "watched"})
+	client.Delete(ctx, &infrapb.Secret{Name: "not existing"})
+
+	expected := []infrapb.SecretEvent_Type{
+		infrapb.SecretEvent_RENEWED,
+		infrapb.SecretEvent_UPDATED,
+		infrapb.SecretEvent_DELETED,
+	}
+
+	for i, eventType := range expected {
+		event, err := stream.Recv()
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if event.Type != eventType {
+			t.Fatalf("Expected a %s event, got %s", eventType, event.Type)
+		}
+
+		if event.Revision != uint64(i+2) {
+			t.Fatalf("Expected revision %d, got %d", i+2, event.Revision)
+		}
+
+		if event.Secret.Name != "watched" {
+			t.Fatalf("Expected an event on \"watched\", got \"%s\"", event.Secret.Name)
+		}
+	}
+
+	if _, err := client.Create(ctx, &infrapb.Secret{Name: "watched again"}); err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	event, err := stream.Recv()
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if event.Type != infrapb.SecretEvent_CREATED || event.Revision != 5 || event.Secret.Token == "" {
+		t.Fatalf("Expected a created event with the token at revision 5, got %v", event)
+	}
+}
+
+func TestWatchFromUnavailableRevision(t *testing.T) {
+	conn := newTestConnection(t, NewSecretStore())
+	conn.service.events = newEventBroker(2)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+
+	for i := 0; i < 4; i++ {
+		client.Create(ctx, &infrapb.Secret{Name: fmt.Sprintf("s-%d", i)})
+	}
+
+	tests := map[string]uint64{
+		// e.g. a revision received before the service restarted
+		"future":    42,
+		"compacted": 1,
+	}
+
+	for name, revision := range tests {
+		t.Run(name, func(t *testing.T) {
+			stream, _ := client.Watch(ctx, &infrapb.WatchRequest{FromRevision: revision})
+			_, err := stream.Recv()
+
+			if statusErr, _ := status.FromError(err); statusErr.Code() != codes.OutOfRange {
+				t.Fatalf("Expected a status %s, got %s", codes.OutOfRange, statusErr.Code())
+			}
+		})
+	}
+}
+
+func TestEventBrokerCompaction(t *testing.T) {
+	broker := newEventBroker(2)
+
+	for i := 0; i < 4; i++ {
+		broker.publish(SecretCreated, NewSecret("foo", time.Hour))
+	}
+
+	if _, err := broker.subscribe(1); !errors.Is(err, ErrRevisionCompacted) {
+		t.Fatalf("Expected %s, got %v", ErrRevisionCompacted, err)
+	}
+
+	if _, err := broker.subscribe(42); !errors.Is(err, ErrRevisionInFuture) {
+		t.Fatalf("Expected %s, got %v", ErrRevisionInFuture, err)
+	}
+
+	subscription, err := broker.subscribe(2)
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	defer subscription.Close()
+
+	for _, revision := range []uint64{3, 4} {
+		if event := <-subscription.Events(); event.Revision != revision {
+			t.Fatalf("Expected revision %d, got %d", revision, event.Revision)
+		}
+	}
+}
+
+func TestEventBrokerOverflow(t *testing.T) {
+	broker := newEventBroker(defaultEventHistory)
+	subscription, _ := broker.subscribe(0)
+
+	for i := 0; i <= subscriptionBufferSize; i++ {
+		broker.publish(SecretRenewed, NewSecret("foo", time.Hour))
+	}
+
+	received := 0
+
+	for range subscription.Events() {
+		received++
+	}
+
+	if received != subscriptionBufferSize {
+		t.Fatalf("Expected %d events before the overflow, got %d", subscriptionBufferSize, received)
+	}
+
+	if !errors.Is(subscription.Err(), ErrSubscriptionOverflow) {
+		t.Fatalf("Expected %s, got %v", ErrSubscriptionOverflow, subscription.Err())
+	}
+}
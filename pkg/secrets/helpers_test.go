@@ -14,24 +14,36 @@ import (
 )
 
 type testConnection struct {
-	conn   *bufconn.Listener
-	t      *testing.T
-	wg     sync.WaitGroup
-	server *grpc.Server
+	conn    *bufconn.Listener
+	t       *testing.T
+	wg      sync.WaitGroup
+	server  *grpc.Server
+	service *Service
 }
 
 func newTestConnection(t *testing.T, store SecretStore) *testConnection {
+	config := Config{
+		SigningKey: []byte(testSigningKey),
+	}
+
+	return newTestConnectionWithConfig(t, store, config)
+}
+
+func newTestConnectionWithConfig(t *testing.T, store SecretStore, config Config) *testConnection {
 	c := testConnection{
 		conn:   bufconn.Listen(1024 * 1024),
 		t:      t,
 		server: grpc.NewServer(),
 	}
 
-	config := Config{
-		SigningKey: []byte(testSigningKey),
+	service, err := NewService(store, config)
+
+	if err != nil {
+		t.Fatalf("Couldn't create service: %v", err)
 	}
 
-	infrapb.RegisterSecretsServer(c.server, NewService(store, config))
+	c.service = service
+	infrapb.RegisterSecretsServer(c.server, service)
 
 	return &c
 }
@@ -0,0 +1,133 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// errVersionNotFound is returned when rolling back to a version which is not kept anymore.
+var errVersionNotFound = errors.New("no such version")
+
+// recordVersion adds the secret as it is about to be saved to its history, dropping the oldest
+// versions beyond HistorySize.
+func (s *Service) recordVersion(secret *Secret, author string) {
+	secret.History = append(secret.History, SecretVersion{
+		Version:   secret.Revision + 1,
+		Claims:    copyClaims(secret.Claims),
+		Token:     secret.Token,
+		ExpiresAt: secret.ExpiresAt,
+		CreatedAt: time.Now(),
+		Author:    author,
+	})
+
+	if len(secret.History) > s.config.HistorySize {
+		secret.History = secret.History[len(secret.History)-s.config.HistorySize:]
+	}
+}
+
+// author returns the address of the client making the request.
+func author(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+
+	return ""
+}
+
+func (s *Service) ListVersions(ctx context.Context, in *infrapb.SecretRef) (*infrapb.SecretVersionList, error) {
+	secret, err := s.store.Fetch(ctx, in.Namespace, in.Name)
+
+	if errors.Is(err, ErrSecretNotFound) {
+		return &infrapb.SecretVersionList{}, status.Errorf(codes.NotFound, "secret name \"%s\" doesn't exists", in.Name)
+	}
+
+	if err != nil {
+		return &infrapb.SecretVersionList{}, status.Errorf(codes.Internal, "couldn't fetch secret : %s", err)
+	}
+
+	versions := make([]*infrapb.SecretVersion, 0, len(secret.History))
+
+	for _, version := range secret.History {
+		result := &infrapb.SecretVersion{
+			Version:   version.Version,
+			Token:     version.Token,
+			ExpiresAt: timestamppb.New(version.ExpiresAt),
+			CreatedAt: timestamppb.New(version.CreatedAt),
+			Author:    version.Author,
+		}
+
+		result.Claims, result.TypedClaims = claimsToProto(version.Claims)
+		versions = append(versions, result)
+	}
+
+	return &infrapb.SecretVersionList{Versions: versions}, nil
+}
+
+func (s *Service) Rollback(ctx context.Context, in *infrapb.RollbackRequest) (*infrapb.SecretDetails, error) {
+	secret, err := s.store.Fetch(ctx, in.Namespace, in.Name)
+
+	if errors.Is(err, ErrSecretNotFound) {
+		return &infrapb.SecretDetails{}, status.Errorf(codes.NotFound, "secret name \"%s\" doesn't exists", in.Name)
+	}
+
+	if err != nil {
+		return &infrapb.SecretDetails{}, status.Errorf(codes.Internal, "couldn't fetch secret : %s", err)
+	}
+
+	secret, err = s.updateSecret(ctx, secret, func(secret *Secret) error {
+		var claims map[string]interface{}
+
+		for _, version := range secret.History {
+			if version.Version == in.Version {
+				claims = copyClaims(version.Claims)
+			}
+		}
+
+		if claims == nil {
+			return errVersionNotFound
+		}
+
+		// the previous expiration date is most likely already passed
+		expiresAt := time.Now().Add(s.ttl(*secret))
+		claims["exp"] = expiresAt.Unix()
+
+		token, err := createToken(secret.Name, s.tokenClaims(secret.Namespace, claims), s.namespace(secret.Namespace).keyring.Active())
+
+		if err != nil {
+			return fmt.Errorf("couldn't encode jwt : %w", err)
+		}
+
+		secret.Claims = claims
+		secret.Token = token
+		secret.ExpiresAt = time.Unix(expiresAt.Unix(), 0)
+		secret.RenewedAt = time.Now()
+		recordIssuedToken(secret)
+		s.recordVersion(secret, author(ctx))
+
+		return nil
+	})
+
+	if errors.Is(err, errVersionNotFound) || errors.Is(err, ErrSecretNotFound) {
+		return &infrapb.SecretDetails{}, status.Errorf(codes.NotFound, "version %d of secret name \"%s\" doesn't exists", in.Version, in.Name)
+	}
+
+	if errors.Is(err, ErrSecretConflict) {
+		return &infrapb.SecretDetails{}, status.Errorf(codes.Aborted, "secret name \"%s\" kept being modified while being rolled back", in.Name)
+	}
+
+	if err != nil {
+		return &infrapb.SecretDetails{}, status.Errorf(codes.Internal, "couldn't rollback secret : %s", err)
+	}
+
+	s.events.publish(SecretUpdated, secret)
+
+	return newSecretDetails(secret), nil
+}
@@ -0,0 +1,100 @@
+package secrets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestListVersions(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnectionWithConfig(t, store, Config{SigningKey: []byte(testSigningKey), HistorySize: 2})
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+	client.Create(ctx, &infrapb.Secret{Name: "foo", Claims: map[string]string{"Foo": "first"}})
+	client.Update(ctx, &infrapb.Secret{Name: "foo", Claims: map[string]string{"Foo": "second"}})
+	client.Update(ctx, &infrapb.Secret{Name: "foo", Claims: map[string]string{"Foo": "third"}})
+
+	// the claims don't change on renewal, which is not a new version
+	if _, err := client.Renew(ctx, &infrapb.RenewRequest{Name: "foo"}); err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	res, err := client.ListVersions(ctx, &infrapb.SecretRef{Name: "foo"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if len(res.Versions) != 2 {
+		t.Fatalf("Expected the last 2 versions, got %d", len(res.Versions))
+	}
+
+	if res.Versions[0].Version != 2 || res.Versions[0].Claims["Foo"] != "second" || res.Versions[1].Claims["Foo"] != "third" {
+		t.Fatalf("Unexpected versions : %v", res.Versions)
+	}
+
+	if res.Versions[1].Author == "" || res.Versions[1].Token == "" {
+		t.Fatalf("Versions should have an author and a token : %v", res.Versions[1])
+	}
+
+	_, err = client.ListVersions(ctx, &infrapb.SecretRef{Name: "not existing"})
+
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected a NotFound error, got %v", err)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+	client.Create(ctx, &infrapb.Secret{Name: "foo", Claims: map[string]string{"Foo": "good"}})
+	client.Update(ctx, &infrapb.Secret{Name: "foo", Claims: map[string]string{"Foo": "bad", "Bar": "bad"}})
+
+	t.Run("existing version", func(t *testing.T) {
+		res, err := client.Rollback(ctx, &infrapb.RollbackRequest{Name: "foo", Version: 1})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if res.Claims["Foo"] != "good" || res.Claims["Bar"] != "" {
+			t.Fatalf("Claims should be the ones of the first version, got %v", res.Claims)
+		}
+
+		if !res.ExpiresAt.AsTime().After(time.Now()) {
+			t.Fatalf("Rolled back token should not be expired, expires at %s", res.ExpiresAt.AsTime())
+		}
+
+		secret, _ := store.Fetch(ctx, "", "foo")
+
+		if secret.Token != res.Token || len(secret.History) != 3 || secret.History[2].Version != 3 {
+			t.Fatalf("Rollback should have been saved as a new version, got %v", secret)
+		}
+	})
+
+	t.Run("not kept version", func(t *testing.T) {
+		_, err := client.Rollback(ctx, &infrapb.RollbackRequest{Name: "foo", Version: 42})
+
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Expected a NotFound error, got %v", err)
+		}
+	})
+}
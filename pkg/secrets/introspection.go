@@ -0,0 +1,63 @@
+package secrets
+
+import (
+	"context"
+	"time"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"github.com/golang-jwt/jwt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *Service) Introspect(ctx context.Context, in *infrapb.IntrospectRequest) (*infrapb.IntrospectResponse, error) {
+	// the token is verified with the key of its namespace, which is only trusted once verified
+	unverified := jwt.MapClaims{}
+	new(jwt.Parser).ParseUnverified(in.Token, unverified)
+	namespace, _ := unverified["namespace"].(string)
+
+	// the expiration date, as well as the "nbf" and "iat" claims, are checked while parsing
+	token, err := jwt.Parse(in.Token, s.namespace(namespace).keyring.keyfunc)
+
+	if err != nil || !token.Valid {
+		return &infrapb.IntrospectResponse{Active: false}, nil
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	id, _ := claims["jti"].(string)
+
+	if id != "" {
+		revoked, err := s.revocations.Contains(ctx, id)
+
+		if err != nil {
+			return &infrapb.IntrospectResponse{}, status.Errorf(codes.Internal, "couldn't check the revocation of the token : %s", err)
+		}
+
+		if revoked {
+			return &infrapb.IntrospectResponse{Active: false}, nil
+		}
+	}
+
+	structClaims, err := structpb.NewStruct(claims)
+
+	if err != nil {
+		return &infrapb.IntrospectResponse{}, status.Errorf(codes.Internal, "couldn't encode claims : %s", err)
+	}
+
+	response := &infrapb.IntrospectResponse{
+		Active:    true,
+		Jti:       id,
+		Namespace: namespace,
+		Claims:    structClaims,
+	}
+
+	response.Name, _ = claims["id"].(string)
+
+	if exp, ok := claims["exp"].(float64); ok {
+		response.ExpiresAt = timestamppb.New(time.Unix(int64(exp), 0))
+	}
+
+	return response, nil
+}
@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+)
+
+func TestIntrospect(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+	client.Create(ctx, &infrapb.Secret{Name: "foo", Claims: map[string]string{"Foo": "bar"}})
+	client.Create(ctx, &infrapb.Secret{Name: "revoked"})
+
+	secret, _ := store.Fetch(ctx, "", "foo")
+	revoked, _ := store.Fetch(ctx, "", "revoked")
+	client.Revoke(ctx, &infrapb.RevokeRequest{Name: "revoked"})
+
+	otherKey, _ := NewSigningKey("HS256", []byte("another key"))
+	forged, _ := createToken("foo", map[string]interface{}{"exp": fmt.Sprint(time.Now().Add(time.Hour).Unix())}, otherKey)
+	expired, _ := createToken("foo", map[string]interface{}{"exp": fmt.Sprint(time.Now().Add(-time.Hour).Unix())}, conn.service.keyring.Active())
+
+	t.Run("active token", func(t *testing.T) {
+		res, err := client.Introspect(ctx, &infrapb.IntrospectRequest{Token: secret.Token})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if !res.Active || res.Name != "foo" || res.Jti == "" {
+			t.Fatalf("Expected an active token of secret \"foo\", got %v", res)
+		}
+
+		if res.Claims.Fields["Foo"].GetStringValue() != "bar" || !res.ExpiresAt.AsTime().Equal(time.Unix(secret.ExpiresAt.Unix(), 0)) {
+			t.Fatalf("Expected the claims of the token, got %v", res)
+		}
+	})
+
+	tests := map[string]string{
+		"revoked token":    revoked.Token,
+		"expired token":    expired,
+		"forged token":     forged,
+		"not a jwt at all": "foo",
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, err := client.Introspect(ctx, &infrapb.IntrospectRequest{Token: token})
+
+			if err != nil {
+				t.Fatalf("Unexpected error : %s", err)
+			}
+
+			if res.Active || res.Name != "" || res.Claims != nil {
+				t.Fatalf("Expected an inactive token, got %v", res)
+			}
+		})
+	}
+}
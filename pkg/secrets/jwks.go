@@ -0,0 +1,141 @@
+package secrets
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+)
+
+// JSONWebKey is the public part of a signing key, as described by RFC 7517.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKey returns the public part of the key. The HMAC keys are secret, and can't be published.
+func (k SigningKey) JSONWebKey() (JSONWebKey, bool) {
+	jwk := JSONWebKey{
+		Kid: k.ID,
+		Use: "sig",
+		Alg: k.Method.Alg(),
+	}
+
+	switch public := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeBase64(public.N.Bytes())
+		jwk.E = encodeBase64(big.NewInt(int64(public.E)).Bytes())
+
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+
+		jwk.Kty = "EC"
+		jwk.Crv = public.Curve.Params().Name
+		jwk.X = encodeBase64(public.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeBase64(public.Y.FillBytes(make([]byte, size)))
+
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeBase64(public)
+
+	default:
+		return JSONWebKey{}, false
+	}
+
+	return jwk, true
+}
+
+// JSONWebKeySet returns the public keys of the keyring that can be used to verify the tokens.
+func (k *Keyring) JSONWebKeySet() []JSONWebKey {
+	keys := make([]JSONWebKey, 0)
+
+	for _, key := range k.Keys() {
+		if jwk, ok := key.JSONWebKey(); ok {
+			keys = append(keys, jwk)
+		}
+	}
+
+	return keys
+}
+
+// jsonWebKeySet returns the public keys of every keyring of the service, the namespaces sharing a
+// key being listed only once.
+func (s *Service) jsonWebKeySet() []JSONWebKey {
+	keys := make([]JSONWebKey, 0)
+	seen := make(map[string]bool)
+
+	for _, keyring := range s.keyrings() {
+		for _, jwk := range keyring.JSONWebKeySet() {
+			if seen[jwk.Kid] {
+				continue
+			}
+
+			seen[jwk.Kid] = true
+			keys = append(keys, jwk)
+		}
+	}
+
+	return keys
+}
+
+func (s *Service) GetJWKS(ctx context.Context, in *infrapb.Empty) (*infrapb.JWKS, error) {
+	keys := make([]*infrapb.JWK, 0)
+
+	for _, jwk := range s.jsonWebKeySet() {
+		keys = append(
+			keys,
+			&infrapb.JWK{
+				Kty: jwk.Kty,
+				Kid: jwk.Kid,
+				Use: jwk.Use,
+				Alg: jwk.Alg,
+				N:   jwk.N,
+				E:   jwk.E,
+				Crv: jwk.Crv,
+				X:   jwk.X,
+				Y:   jwk.Y,
+			},
+		)
+	}
+
+	return &infrapb.JWKS{Keys: keys}, nil
+}
+
+// JWKSHandler serves the public keys as a JSON Web Key Set, typically on /.well-known/jwks.json.
+func (s *Service) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		w.Header().Set("Cache-Control", "max-age=300")
+
+		json.NewEncoder(w).Encode(struct {
+			Keys []JSONWebKey `json:"keys"`
+		}{
+			Keys: s.jsonWebKeySet(),
+		})
+	})
+}
+
+func encodeBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
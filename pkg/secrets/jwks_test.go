@@ -0,0 +1,106 @@
+package secrets
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestGetJWKS(t *testing.T) {
+	active := newTestSigningKey(t, "ES256")
+	retired := newTestSigningKey(t, "RS256")
+	hmac, _ := NewSigningKey("HS256", []byte(testSigningKey))
+	hmac.ID = "hmac"
+
+	keyring, _ := NewKeyring(active, retired, hmac)
+
+	conn := newTestConnectionWithConfig(t, NewSecretStore(), Config{Keyring: keyring})
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+	res, err := client.GetJWKS(ctx, &infrapb.Empty{})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if len(res.Keys) != 2 {
+		t.Fatalf("Expected 2 public keys, got %d", len(res.Keys))
+	}
+
+	if res.Keys[0].Kid != active.ID || res.Keys[0].Kty != "EC" || res.Keys[0].Crv != "P-256" {
+		t.Fatalf("Expected the active key first, got %v", res.Keys[0])
+	}
+
+	if res.Keys[1].Kid != retired.ID || res.Keys[1].Kty != "RSA" {
+		t.Fatalf("Expected the retired key, got %v", res.Keys[1])
+	}
+
+	// the published key must be enough to verify a token
+	x, _ := base64.RawURLEncoding.DecodeString(res.Keys[0].X)
+	y, _ := base64.RawURLEncoding.DecodeString(res.Keys[0].Y)
+
+	public := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+
+	signed, _ := createToken("foo", map[string]interface{}{"exp": "4102444800"}, active)
+	token, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+		return public, nil
+	})
+
+	if err != nil || !token.Valid {
+		t.Fatalf("Token should be verifiable with the published key (%s)", err)
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	active := newTestSigningKey(t, "EdDSA")
+	keyring, _ := NewKeyring(active)
+	service, _ := NewService(NewSecretStore(), Config{Keyring: keyring})
+
+	t.Run("GET", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		service.JWKSHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected a %d status, got %d", http.StatusOK, recorder.Code)
+		}
+
+		var set struct {
+			Keys []JSONWebKey `json:"keys"`
+		}
+
+		if err := json.NewDecoder(recorder.Body).Decode(&set); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if len(set.Keys) != 1 || set.Keys[0].Kty != "OKP" || set.Keys[0].Crv != "Ed25519" || set.Keys[0].Kid != active.ID {
+			t.Fatalf("Unexpected key set %v", set.Keys)
+		}
+	})
+
+	t.Run("POST", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		service.JWKSHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/.well-known/jwks.json", nil))
+
+		if recorder.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("Expected a %d status, got %d", http.StatusMethodNotAllowed, recorder.Code)
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package secrets
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Keyring holds the keys used by the service. New tokens are always signed with the active key,
+// while the retired keys are only kept to verify the tokens they signed, until those are renewed.
+//
+// Rotating keys is thus done by activating a new key and retiring the current one : the tokens
+// signed by the retired key are still accepted when renewing them, and they are then re-signed
+// with the new active key.
+type Keyring struct {
+	lock    sync.RWMutex
+	active  SigningKey
+	retired map[string]retiredKey
+}
+
+type retiredKey struct {
+	key SigningKey
+
+	// until is the time after which the key is not used anymore. A zero value means the key is
+	// kept until it is explicitly removed.
+	until time.Time
+}
+
+// NewKeyring creates a keyring with an active key, and some retired keys used only for verification.
+func NewKeyring(active SigningKey, retired ...SigningKey) (*Keyring, error) {
+	k := &Keyring{}
+
+	if err := k.SetKeys(active, retired...); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// SetKeys replaces every key held by the keyring.
+func (k *Keyring) SetKeys(active SigningKey, retired ...SigningKey) error {
+	keys := make(map[string]retiredKey, len(retired))
+
+	for _, key := range retired {
+		if key.ID == "" {
+			return fmt.Errorf("retired keys must have an ID")
+		}
+
+		if _, exists := keys[key.ID]; exists || key.ID == active.ID {
+			return fmt.Errorf("duplicate key ID \"%s\"", key.ID)
+		}
+
+		keys[key.ID] = retiredKey{key: key}
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	k.active = active
+	k.retired = keys
+
+	return nil
+}
+
+// Active returns the key currently used to sign the tokens.
+func (k *Keyring) Active() SigningKey {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	return k.active
+}
+
+// Rotate activates a new signing key. The previously active key is retired, and kept to verify
+// the tokens it signed for the given retention period (forever if it's 0).
+func (k *Keyring) Rotate(next SigningKey, retention time.Duration) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if next.ID == "" || k.active.ID == "" {
+		return fmt.Errorf("keys must have an ID to be rotated")
+	}
+
+	if _, exists := k.retired[next.ID]; exists || next.ID == k.active.ID {
+		return fmt.Errorf("duplicate key ID \"%s\"", next.ID)
+	}
+
+	retired := retiredKey{key: k.active}
+
+	if retention > 0 {
+		retired.until = time.Now().Add(retention)
+	}
+
+	k.retired[k.active.ID] = retired
+	k.active = next
+
+	return nil
+}
+
+// Remove removes a retired key from the keyring. The tokens it signed can't be verified anymore.
+func (k *Keyring) Remove(id string) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	delete(k.retired, id)
+}
+
+// Lookup returns the key with the given ID, if it's either the active key or a retired key that
+// is still valid.
+func (k *Keyring) Lookup(id string) (SigningKey, bool) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	if id == k.active.ID {
+		return k.active, true
+	}
+
+	retired, ok := k.retired[id]
+
+	if !ok || (!retired.until.IsZero() && time.Now().After(retired.until)) {
+		return SigningKey{}, false
+	}
+
+	return retired.key, true
+}
+
+// Keys returns the active key, followed by the retired keys that are still valid.
+func (k *Keyring) Keys() []SigningKey {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	keys := []SigningKey{k.active}
+	now := time.Now()
+
+	for _, retired := range k.retired {
+		if !retired.until.IsZero() && now.After(retired.until) {
+			continue
+		}
+
+		keys = append(keys, retired.key)
+	}
+
+	sort.Slice(keys[1:], func(i, j int) bool {
+		return keys[i+1].ID < keys[j+1].ID
+	})
+
+	return keys
+}
+
+// keyfunc picks the key to verify a token with its "kid" header. Tokens without a "kid" header
+// were issued before the keys had IDs, and are verified with the key whose signature matches.
+func (k *Keyring) keyfunc(token *jwt.Token) (interface{}, error) {
+	id, hasID := token.Header["kid"].(string)
+
+	if !hasID {
+		return k.signingKey(token).keyfunc(token)
+	}
+
+	key, ok := k.Lookup(id)
+
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID \"%s\"", id)
+	}
+
+	return key.keyfunc(token)
+}
+
+// signingKey finds the key which signed a token by checking its signature against every key, the
+// active key being returned if none of them signed it.
+func (k *Keyring) signingKey(token *jwt.Token) SigningKey {
+	keys := k.Keys()
+
+	if i := strings.LastIndex(token.Raw, "."); i >= 0 {
+		for _, key := range keys {
+			if key.Method.Alg() == token.Method.Alg() && key.Method.Verify(token.Raw[:i], token.Raw[i+1:], key.Public) == nil {
+				return key
+			}
+		}
+	}
+
+	return keys[0]
+}
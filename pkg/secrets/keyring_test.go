@@ -0,0 +1,214 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"github.com/golang-jwt/jwt"
+)
+
+func newTestSigningKey(t *testing.T, algorithm string) SigningKey {
+	key, err := NewSigningKey(algorithm, generateTestPrivateKey(t, algorithm))
+
+	if err != nil {
+		t.Fatalf("couldn't create %s signing key : %s", algorithm, err)
+	}
+
+	return key
+}
+
+func TestKeyringRotation(t *testing.T) {
+	ctx := context.TODO()
+	store := NewSecretStore()
+
+	previous := newTestSigningKey(t, "ES256")
+	next := newTestSigningKey(t, "EdDSA")
+
+	keyring, err := NewKeyring(previous)
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	claims := map[string]interface{}{
+		"exp": fmt.Sprint(time.Now().Add(time.Minute).Unix()),
+	}
+
+	token, _ := createToken("rotated", claims, keyring.Active())
+
+	store.Save(
+		ctx,
+		Secret{
+			Name:      "rotated",
+			ExpiresAt: time.Now().Add(time.Minute),
+			Claims:    claims,
+			Token:     token,
+		},
+	)
+
+	if err := keyring.Rotate(next, time.Hour); err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if _, err := parseToken(token, keyring.keyfunc); err != nil {
+		t.Fatalf("A token signed by a retired key should still be verified : %s", err)
+	}
+
+	service, _ := NewService(store, Config{Keyring: keyring})
+	service.renewExpiredSecrets(ctx, keyring, time.Hour, 5*time.Hour)
+
+	secret, _ := store.Fetch(ctx, "", "rotated")
+	renewed, err := parseToken(secret.Token, keyring.keyfunc)
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if renewed.Header["kid"] != next.ID {
+		t.Fatalf("Renewed token should be signed by %s, got %v", next.ID, renewed.Header["kid"])
+	}
+}
+
+func TestKeyringLookup(t *testing.T) {
+	active := newTestSigningKey(t, "ES256")
+	retired := newTestSigningKey(t, "RS256")
+	expired := newTestSigningKey(t, "EdDSA")
+
+	keyring, _ := NewKeyring(expired, retired)
+	keyring.Rotate(active, time.Nanosecond)
+
+	time.Sleep(time.Millisecond)
+
+	if _, ok := keyring.Lookup(active.ID); !ok {
+		t.Error("Active key should be found")
+	}
+
+	if _, ok := keyring.Lookup(retired.ID); !ok {
+		t.Error("Retired key without retention should be found")
+	}
+
+	if _, ok := keyring.Lookup(expired.ID); ok {
+		t.Error("Retired key past its retention should not be found")
+	}
+
+	keyring.Remove(retired.ID)
+
+	if _, ok := keyring.Lookup(retired.ID); ok {
+		t.Error("Removed key should not be found")
+	}
+}
+
+func TestKeyringTokenWithoutKeyID(t *testing.T) {
+	// the HMAC keys had no ID before they were derived from the shared secret
+	legacy, _ := NewSigningKey("HS256", []byte(testSigningKey))
+	legacy.ID = ""
+	signed, _ := createToken("legacy", map[string]interface{}{"exp": "4102444800"}, legacy)
+
+	active := legacy
+	active.ID = "hmac"
+
+	keyring, _ := NewKeyring(active)
+
+	if _, err := parseToken(signed, keyring.keyfunc); err != nil {
+		t.Fatalf("A token without kid should be verified with the active key : %s", err)
+	}
+
+	token, _, _ := new(jwt.Parser).ParseUnverified(signed, jwt.MapClaims{})
+
+	if _, ok := token.Header["kid"]; ok {
+		t.Fatal("A key without ID should not set a kid header")
+	}
+}
+
+func TestKeyringRotationFromHMACWithoutKeyID(t *testing.T) {
+	ctx := context.TODO()
+	store := NewSecretStore()
+
+	legacy, _ := NewSigningKey("HS256", []byte("previous signing key"))
+	legacy.ID = ""
+
+	claims := map[string]interface{}{"exp": fmt.Sprint(time.Now().Add(time.Hour).Unix())}
+	token, _ := createToken("legacy", claims, legacy)
+
+	store.Save(ctx, Secret{Name: "legacy", ExpiresAt: time.Now().Add(time.Hour), Claims: claims, Token: token})
+
+	service, err := NewService(store, Config{
+		SigningKey:         []byte(testSigningKey),
+		RetiredSigningKeys: []RetiredSigningKey{{ID: "previous", Secret: []byte("previous signing key")}},
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if _, err := service.Renew(ctx, &infrapb.RenewRequest{Name: "legacy"}); err != nil {
+		t.Fatalf("A token signed by a retired key without kid should be renewed : %s", err)
+	}
+
+	secret, _ := store.Fetch(ctx, "", "legacy")
+	renewed, err := parseToken(secret.Token, service.keyring.keyfunc)
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if renewed.Header["kid"] != SecretKeyID([]byte(testSigningKey)) {
+		t.Fatalf("Renewed token should be signed by the active key, got %v", renewed.Header["kid"])
+	}
+
+	// a token without kid which wasn't signed by any key is still rejected
+	forged, _ := createToken("legacy", claims, SigningKey{Method: jwt.SigningMethodHS256, Private: []byte("unknown")})
+
+	if _, err := parseToken(forged, service.keyring.keyfunc); err == nil {
+		t.Fatal("A token signed by an unknown key should not be verified")
+	}
+}
+
+func TestKeyringRetiredKeysWithoutID(t *testing.T) {
+	ctx := context.TODO()
+	store := NewSecretStore()
+	retired := []RetiredSigningKey{{Secret: []byte("first signing key")}, {Secret: []byte("second signing key")}}
+
+	for _, retiredKey := range retired {
+		key, _ := NewSigningKey("HS256", retiredKey.Secret)
+		claims := map[string]interface{}{"exp": fmt.Sprint(time.Now().Add(time.Hour).Unix())}
+		token, _ := createToken(string(retiredKey.Secret), claims, key)
+
+		store.Save(ctx, Secret{Name: string(retiredKey.Secret), ExpiresAt: time.Now().Add(time.Hour), Claims: claims, Token: token})
+	}
+
+	service, err := NewService(store, Config{SigningKey: []byte(testSigningKey), RetiredSigningKeys: retired})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	for _, retiredKey := range retired {
+		if _, err := service.Renew(ctx, &infrapb.RenewRequest{Name: string(retiredKey.Secret)}); err != nil {
+			t.Fatalf("A token signed by every retired key without ID should be renewed : %s", err)
+		}
+	}
+
+	retired = append(retired, RetiredSigningKey{ID: SecretKeyID([]byte("first signing key")), Secret: []byte("other signing key")})
+
+	if _, err := NewService(store, Config{SigningKey: []byte(testSigningKey), RetiredSigningKeys: retired}); err == nil {
+		t.Fatal("Expected an error when a retired key ID is used twice")
+	}
+}
+
+func TestKeyringDuplicateKeyID(t *testing.T) {
+	key := newTestSigningKey(t, "ES256")
+
+	if _, err := NewKeyring(key, key); err == nil {
+		t.Fatal("Expected an error when a key ID is used twice")
+	}
+
+	keyring, _ := NewKeyring(key)
+
+	if err := keyring.Rotate(key, 0); err == nil {
+		t.Fatal("Expected an error when rotating to the active key")
+	}
+}
@@ -0,0 +1,64 @@
+package secrets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+const (
+	kubernetesManagedByLabel = "app.kubernetes.io/managed-by"
+	kubernetesManagedBy      = "challenge-jwt-secrets"
+
+	kubernetesNameAnnotation      = "secrets.challenge-jwt.taluu.github.io/name"
+	kubernetesExpiresAtAnnotation = "secrets.challenge-jwt.taluu.github.io/expires-at"
+
+	// kubernetesNamespaceLabel holds the namespace of the secret, if not the default one. It is a
+	// label, so that the secrets of a namespace can be selected.
+	kubernetesNamespaceLabel = "secrets.challenge-jwt.taluu.github.io/namespace"
+
+	defaultKubernetesDataKey = "token"
+
+	// kubernetesNameMaxLength is the maximum length of a DNS subdomain (RFC 1123), which is what
+	// Kubernetes expects for a Secret name.
+	kubernetesNameMaxLength = 253
+)
+
+var kubernetesInvalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// kubernetesSecretName converts a secret name into a valid Kubernetes Secret name. As the
+// conversion may map several names to the same one, a hash of the original name is appended
+// whenever it had to be altered.
+func kubernetesSecretName(prefix string, name string) string {
+	original := prefix + name
+	converted := strings.Trim(kubernetesInvalidNameChars.ReplaceAllString(strings.ToLower(original), "-"), "-.")
+
+	if converted == original && len(converted) <= kubernetesNameMaxLength {
+		return converted
+	}
+
+	hash := sha256.Sum256([]byte(name))
+	suffix := hex.EncodeToString(hash[:4])
+
+	if maxLength := kubernetesNameMaxLength - len(suffix) - 1; len(converted) > maxLength {
+		converted = strings.TrimRight(converted[:maxLength], "-.")
+	}
+
+	if converted == "" {
+		return suffix
+	}
+
+	return converted + "-" + suffix
+}
+
+// setNamespaceLabel sets the namespace label of a Kubernetes Secret, the secrets of the default
+// namespace having none.
+func setNamespaceLabel(labels map[string]string, namespace string) {
+	if namespace == "" {
+		delete(labels, kubernetesNamespaceLabel)
+		return
+	}
+
+	labels[kubernetesNamespaceLabel] = namespace
+}
@@ -0,0 +1,325 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const defaultKubernetesResyncDelay = 5 * time.Second
+
+// KubernetesSyncConfig configures how the secrets are mirrored into Kubernetes Secrets.
+type KubernetesSyncConfig struct {
+	Namespace string
+
+	// NamePrefix is prepended to the name of the Kubernetes Secrets.
+	NamePrefix string
+
+	// DataKey is the key of the Kubernetes Secret data holding the token ("token" by default).
+	DataKey string
+
+	// Labels are added to every Kubernetes Secret, on top of the managed-by label used to find
+	// the secrets handled by the syncer.
+	Labels map[string]string
+}
+
+// KubernetesSyncer mirrors each secret of the service into a Kubernetes Secret, so that game
+// servers can be given their token through an environment variable.
+type KubernetesSyncer struct {
+	client kubernetes.Interface
+	config KubernetesSyncConfig
+}
+
+func NewKubernetesSyncer(client kubernetes.Interface, config KubernetesSyncConfig) *KubernetesSyncer {
+	if config.DataKey == "" {
+		config.DataKey = defaultKubernetesDataKey
+	}
+
+	return &KubernetesSyncer{
+		client: client,
+		config: config,
+	}
+}
+
+// kubernetesSyncKey identifies a secret whose Kubernetes Secret has to be synced.
+type kubernetesSyncKey struct {
+	namespace string
+	name      string
+}
+
+// Run keeps the Kubernetes Secrets in sync with the service's secrets, until the context is done.
+// Every secret is synced on startup, and then on each change. The changed secrets are queued, each
+// of them only once however many times it changed, and their Kubernetes Secrets are synced with
+// what the store holds, the failed ones being tried again later. If the syncer falls behind the
+// changes, every secret is queued again.
+func (k *KubernetesSyncer) Run(ctx context.Context, service *Service) {
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+
+	go k.watch(ctx, service, queue)
+
+	go func() {
+		<-ctx.Done()
+		queue.ShutDown()
+	}()
+
+	for k.reconcileNext(ctx, service, queue) {
+	}
+}
+
+// watch queues the changed secrets, until the context is done.
+func (k *KubernetesSyncer) watch(ctx context.Context, service *Service, queue workqueue.Interface) {
+	for {
+		err := k.queueChanges(ctx, service, queue)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("kubernetes sync interrupted, resyncing in %s : %s", defaultKubernetesResyncDelay, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(defaultKubernetesResyncDelay):
+		}
+	}
+}
+
+func (k *KubernetesSyncer) queueChanges(ctx context.Context, service *Service, queue workqueue.Interface) error {
+	// subscribing first ensures no change is missed while everything is queued
+	subscription, err := service.Subscribe(0)
+
+	if err != nil {
+		return err
+	}
+
+	defer subscription.Close()
+
+	if err := k.queueAll(ctx, service, queue); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return subscription.Err()
+			}
+
+			queue.Add(kubernetesSyncKey{namespace: event.Secret.Namespace, name: event.Secret.Name})
+		}
+	}
+}
+
+// queueAll queues every secret, along with the ones of the Kubernetes Secrets of the syncer, so
+// that the Kubernetes Secrets of the deleted secrets are removed.
+func (k *KubernetesSyncer) queueAll(ctx context.Context, service *Service, queue workqueue.Interface) error {
+	secrets, err := service.store.List(ctx, ListOptions{AllNamespaces: true})
+
+	if err != nil {
+		return fmt.Errorf("couldn't list secrets : %w", err)
+	}
+
+	for _, secret := range secrets {
+		queue.Add(kubernetesSyncKey{namespace: secret.Namespace, name: secret.Name})
+	}
+
+	list, err := k.client.CoreV1().Secrets(k.config.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(k.managedLabels()).String(),
+	})
+
+	if err != nil {
+		return fmt.Errorf("couldn't list kubernetes secrets : %w", err)
+	}
+
+	for _, item := range list.Items {
+		name, ok := item.Annotations[kubernetesNameAnnotation]
+
+		// without its name, the secret of the Kubernetes Secret can't be known
+		if !ok {
+			if err := k.delete(ctx, item.Name); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		queue.Add(kubernetesSyncKey{namespace: item.Labels[kubernetesNamespaceLabel], name: name})
+	}
+
+	return nil
+}
+
+// reconcileNext syncs the Kubernetes Secret of the next queued secret with what the store holds,
+// telling whether the queue is still running.
+func (k *KubernetesSyncer) reconcileNext(ctx context.Context, service *Service, queue workqueue.RateLimitingInterface) bool {
+	item, shutdown := queue.Get()
+
+	if shutdown {
+		return false
+	}
+
+	defer queue.Done(item)
+
+	key := item.(kubernetesSyncKey)
+	secret, err := service.store.Fetch(ctx, key.namespace, key.name)
+
+	switch {
+	case errors.Is(err, ErrSecretNotFound):
+		err = k.Remove(ctx, key.namespace, key.name)
+
+	case err == nil:
+		err = k.Sync(ctx, secret)
+	}
+
+	if err != nil && ctx.Err() == nil {
+		log.Printf("couldn't sync secret \"%s\", retrying : %s", key.name, err)
+		queue.AddRateLimited(item)
+
+		return true
+	}
+
+	queue.Forget(item)
+
+	return true
+}
+
+// Resync syncs every given secret, and removes the Kubernetes Secrets of the ones that don't exist
+// anymore.
+func (k *KubernetesSyncer) Resync(ctx context.Context, secrets []Secret) error {
+	existing := make(map[string]struct{}, len(secrets))
+
+	for _, secret := range secrets {
+		if err := k.Sync(ctx, secret); err != nil {
+			return err
+		}
+
+		existing[k.name(secret.Namespace, secret.Name)] = struct{}{}
+	}
+
+	list, err := k.client.CoreV1().Secrets(k.config.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(k.managedLabels()).String(),
+	})
+
+	if err != nil {
+		return fmt.Errorf("couldn't list kubernetes secrets : %w", err)
+	}
+
+	for _, item := range list.Items {
+		if _, ok := existing[item.Name]; ok {
+			continue
+		}
+
+		if err := k.delete(ctx, item.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Sync creates or updates the Kubernetes Secret of a secret.
+func (k *KubernetesSyncer) Sync(ctx context.Context, secret Secret) error {
+	client := k.client.CoreV1().Secrets(k.config.Namespace)
+	name := k.name(secret.Namespace, secret.Name)
+
+	current, err := client.Get(ctx, name, metav1.GetOptions{})
+
+	if apierrors.IsNotFound(err) {
+		_, err = client.Create(ctx, k.kubernetesSecret(&corev1.Secret{}, secret), metav1.CreateOptions{})
+
+		if err != nil {
+			return fmt.Errorf("couldn't create kubernetes secret \"%s\" : %w", name, err)
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("couldn't fetch kubernetes secret \"%s\" : %w", name, err)
+	}
+
+	_, err = client.Update(ctx, k.kubernetesSecret(current.DeepCopy(), secret), metav1.UpdateOptions{})
+
+	if err != nil {
+		return fmt.Errorf("couldn't update kubernetes secret \"%s\" : %w", name, err)
+	}
+
+	return nil
+}
+
+// Remove deletes the Kubernetes Secret of a secret.
+func (k *KubernetesSyncer) Remove(ctx context.Context, namespace string, name string) error {
+	return k.delete(ctx, k.name(namespace, name))
+}
+
+func (k *KubernetesSyncer) delete(ctx context.Context, name string) error {
+	err := k.client.CoreV1().Secrets(k.config.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("couldn't delete kubernetes secret \"%s\" : %w", name, err)
+	}
+
+	return nil
+}
+
+func (k *KubernetesSyncer) name(namespace string, name string) string {
+	return kubernetesSecretName(k.config.NamePrefix, namespacedKey(namespace, name))
+}
+
+func (k *KubernetesSyncer) managedLabels() map[string]string {
+	return map[string]string{kubernetesManagedByLabel: kubernetesManagedBy}
+}
+
+// kubernetesSecret fills the Kubernetes Secret with the secret's token, keeping what was set by
+// others (e.g. other data keys or annotations).
+func (k *KubernetesSyncer) kubernetesSecret(current *corev1.Secret, secret Secret) *corev1.Secret {
+	current.Name = k.name(secret.Namespace, secret.Name)
+	current.Namespace = k.config.Namespace
+
+	if current.Type == "" {
+		current.Type = corev1.SecretTypeOpaque
+	}
+
+	if current.Labels == nil {
+		current.Labels = make(map[string]string)
+	}
+
+	for key, value := range k.config.Labels {
+		current.Labels[key] = value
+	}
+
+	for key, value := range k.managedLabels() {
+		current.Labels[key] = value
+	}
+
+	setNamespaceLabel(current.Labels, secret.Namespace)
+
+	if current.Annotations == nil {
+		current.Annotations = make(map[string]string)
+	}
+
+	current.Annotations[kubernetesNameAnnotation] = secret.Name
+	current.Annotations[kubernetesExpiresAtAnnotation] = secret.ExpiresAt.UTC().Format(time.RFC3339)
+
+	if current.Data == nil {
+		current.Data = make(map[string][]byte)
+	}
+
+	current.Data[k.config.DataKey] = []byte(secret.Token)
+
+	return current
+}
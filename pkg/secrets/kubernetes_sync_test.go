@@ -0,0 +1,221 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testKubernetesNamespace = "game-servers"
+
+func TestKubernetesSecretName(t *testing.T) {
+	tests := map[string]string{
+		"foo":       "foo",
+		"foo.bar-1": "foo.bar-1",
+		"My Secret": "my-secret-",
+		"---":       "",
+	}
+
+	for name, expectedPrefix := range tests {
+		converted := kubernetesSecretName("", name)
+
+		if converted == name {
+			continue
+		}
+
+		if len(converted) != len(expectedPrefix)+8 || converted[:len(expectedPrefix)] != expectedPrefix {
+			t.Errorf("%s :: Expected \"%s\" followed by a hash, got \"%s\"", name, expectedPrefix, converted)
+		}
+	}
+
+	if kubernetesSecretName("", "My Secret") == kubernetesSecretName("", "my secret") {
+		t.Error("Names differing by their case should not be converted to the same name")
+	}
+}
+
+func TestKubernetesSyncerSync(t *testing.T) {
+	ctx := context.TODO()
+	client := fake.NewSimpleClientset()
+	syncer := NewKubernetesSyncer(client, KubernetesSyncConfig{
+		Namespace: testKubernetesNamespace,
+		DataKey:   "GAME_SERVER_TOKEN",
+		Labels:    map[string]string{"app": "game-server"},
+	})
+
+	secret := NewSecret("foo", time.Hour)
+	secret.Token = "first token"
+
+	if err := syncer.Sync(ctx, secret); err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	created, err := client.CoreV1().Secrets(testKubernetesNamespace).Get(ctx, "foo", metav1.GetOptions{})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if string(created.Data["GAME_SERVER_TOKEN"]) != "first token" {
+		t.Fatalf("Expected the token in the GAME_SERVER_TOKEN key, got %v", created.Data)
+	}
+
+	if created.Labels["app"] != "game-server" || created.Labels[kubernetesManagedByLabel] != kubernetesManagedBy {
+		t.Fatalf("Expected the configured and managed-by labels, got %v", created.Labels)
+	}
+
+	// data set by someone else is kept
+	created.Data["OTHER"] = []byte("kept")
+	client.CoreV1().Secrets(testKubernetesNamespace).Update(ctx, created, metav1.UpdateOptions{})
+
+	secret.Token = "second token"
+
+	if err := syncer.Sync(ctx, secret); err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	updated, _ := client.CoreV1().Secrets(testKubernetesNamespace).Get(ctx, "foo", metav1.GetOptions{})
+
+	if string(updated.Data["GAME_SERVER_TOKEN"]) != "second token" || string(updated.Data["OTHER"]) != "kept" {
+		t.Fatalf("Expected the token to be updated and other data to be kept, got %v", updated.Data)
+	}
+
+	if err := syncer.Remove(ctx, "", "foo"); err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if _, err := client.CoreV1().Secrets(testKubernetesNamespace).Get(ctx, "foo", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("Kubernetes secret should have been deleted, got %v", err)
+	}
+
+	if err := syncer.Remove(ctx, "", "foo"); err != nil {
+		t.Fatalf("Removing an already removed secret should not fail : %s", err)
+	}
+}
+
+func TestKubernetesSyncerResync(t *testing.T) {
+	ctx := context.TODO()
+	client := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "orphan",
+				Namespace: testKubernetesNamespace,
+				Labels:    map[string]string{kubernetesManagedByLabel: kubernetesManagedBy},
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "unmanaged",
+				Namespace: testKubernetesNamespace,
+			},
+		},
+	)
+	syncer := NewKubernetesSyncer(client, KubernetesSyncConfig{Namespace: testKubernetesNamespace})
+
+	if err := syncer.Resync(ctx, []Secret{NewSecret("foo", time.Hour)}); err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	list, _ := client.CoreV1().Secrets(testKubernetesNamespace).List(ctx, metav1.ListOptions{})
+	names := make(map[string]bool)
+
+	for _, item := range list.Items {
+		names[item.Name] = true
+	}
+
+	if !names["foo"] || !names["unmanaged"] || names["orphan"] {
+		t.Fatalf("Expected foo and unmanaged secrets only, got %v", names)
+	}
+}
+
+func TestKubernetesSyncerRun(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	store.Save(ctx, NewSecret("existing", defaultTTL))
+
+	client := fake.NewSimpleClientset()
+	syncer := NewKubernetesSyncer(client, KubernetesSyncConfig{Namespace: testKubernetesNamespace})
+
+	go syncer.Run(ctx, conn.service)
+
+	waitForKubernetesSecret(t, client, "existing", true)
+
+	grpcClient := infrapb.NewSecretsClient(conn.Dial(ctx))
+	grpcClient.Create(ctx, &infrapb.Secret{Name: "created"})
+
+	waitForKubernetesSecret(t, client, "created", true)
+
+	grpcClient.Delete(ctx, &infrapb.Secret{Name: "created"})
+
+	waitForKubernetesSecret(t, client, "created", false)
+}
+
+func TestKubernetesSyncerBurst(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := fake.NewSimpleClientset()
+	syncer := NewKubernetesSyncer(client, KubernetesSyncConfig{Namespace: testKubernetesNamespace})
+
+	go syncer.Run(ctx, conn.service)
+
+	// a batch of changes larger than the subscription buffer, each secret changing several times
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 4*subscriptionBufferSize; j++ {
+			secret := NewSecret(fmt.Sprintf("s-%d", j), defaultTTL)
+			secret.Token = fmt.Sprintf("token %d", i)
+			store.Save(ctx, secret)
+			conn.service.events.publish(SecretRenewed, secret)
+		}
+	}
+
+	// every Kubernetes Secret ends up with the last token
+	for i := 0; i < 100; i++ {
+		list, _ := client.CoreV1().Secrets(testKubernetesNamespace).List(ctx, metav1.ListOptions{})
+		synced := 0
+
+		for _, item := range list.Items {
+			if string(item.Data[defaultKubernetesDataKey]) == "token 2" {
+				synced++
+			}
+		}
+
+		if synced == 4*subscriptionBufferSize {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("Expected every kubernetes secret to be synced with the last token")
+}
+
+func waitForKubernetesSecret(t *testing.T, client *fake.Clientset, name string, exists bool) {
+	for i := 0; i < 100; i++ {
+		_, err := client.CoreV1().Secrets(testKubernetesNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+
+		if exists == (err == nil) {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Kubernetes secret \"%s\" existence should be %v", name, exists)
+}
@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// reservedLabelPrefix is the prefix of the labels and annotations set by the service on the
+// Kubernetes Secrets, which can't be used by the labels of the secrets.
+const reservedLabelPrefix = "secrets.challenge-jwt.taluu.github.io/"
+
+// checkLabels checks that the labels of a secret are valid Kubernetes labels, so that they can be
+// selected with a label selector, and stored as is by the Kubernetes store.
+func checkLabels(secretLabels map[string]string) error {
+	keys := make([]string, 0, len(secretLabels))
+
+	for key := range secretLabels {
+		keys = append(keys, key)
+	}
+
+	// the keys are sorted, so that the first invalid one is always the same
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := checkLabelKey(key); err != nil {
+			return err
+		}
+
+		if errs := validation.IsValidLabelValue(secretLabels[key]); len(errs) > 0 {
+			return fmt.Errorf("value of label \"%s\" : %s", key, strings.Join(errs, ", "))
+		}
+	}
+
+	return nil
+}
+
+func checkLabelKey(key string) error {
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return fmt.Errorf("label \"%s\" : %s", key, strings.Join(errs, ", "))
+	}
+
+	if isReservedLabel(key) {
+		return fmt.Errorf("label \"%s\" is reserved", key)
+	}
+
+	return nil
+}
+
+// isReservedLabel tells whether a label is one of the labels used by the Kubernetes store.
+func isReservedLabel(key string) bool {
+	return strings.HasPrefix(key, reservedLabelPrefix) || key == kubernetesManagedByLabel
+}
+
+// checkRemovedLabels checks that the labels to remove from a secret are not given as well.
+func checkRemovedLabels(removed []string, given map[string]string) error {
+	for _, key := range removed {
+		if _, ok := given[key]; ok {
+			return fmt.Errorf("label \"%s\" can't be both given and removed", key)
+		}
+	}
+
+	return nil
+}
+
+func copyLabels(secretLabels map[string]string) map[string]string {
+	if secretLabels == nil {
+		return nil
+	}
+
+	result := make(map[string]string, len(secretLabels))
+
+	for key, value := range secretLabels {
+		result[key] = value
+	}
+
+	return result
+}
+
+// selectorRequirements returns the requirements of a label selector, none for a nil one.
+func selectorRequirements(selector labels.Selector) labels.Requirements {
+	if selector == nil {
+		return nil
+	}
+
+	requirements, _ := selector.Requirements()
+
+	return requirements
+}
@@ -0,0 +1,125 @@
+package secrets
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"github.com/golang-jwt/jwt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLabels(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+
+	for name, secretLabels := range map[string]map[string]string{
+		"eu-1": {"game": "foo", "region": "eu"},
+		"us-1": {"game": "foo", "region": "us"},
+		"eu-2": {"game": "bar", "region": "eu"},
+	} {
+		if _, err := client.Create(ctx, &infrapb.Secret{Name: name, Labels: secretLabels}); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+	}
+
+	listed := func(selector string) []string {
+		res, err := client.List(ctx, &infrapb.ListRequest{LabelSelector: selector})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		names := make([]string, 0, len(res.Secrets))
+
+		for _, secret := range res.Secrets {
+			names = append(names, secret.Name)
+		}
+
+		sort.Strings(names)
+
+		return names
+	}
+
+	t.Run("labels are not claims", func(t *testing.T) {
+		secret, _ := store.Fetch(ctx, "", "eu-1")
+		token, _ := parseToken(secret.Token, conn.service.keyring.keyfunc)
+
+		if _, ok := token.Claims.(jwt.MapClaims)["game"]; ok {
+			t.Fatalf("Expected the labels not to be in the token, got %v", token.Claims)
+		}
+
+		details, _ := client.Get(ctx, &infrapb.SecretRef{Name: "eu-1"})
+
+		if details.Labels["game"] != "foo" || details.Labels["region"] != "eu" {
+			t.Fatalf("Expected the labels of the secret, got %v", details.Labels)
+		}
+	})
+
+	t.Run("label selector", func(t *testing.T) {
+		if names := listed("game=foo,region in (eu,us)"); !reflect.DeepEqual(names, []string{"eu-1", "us-1"}) {
+			t.Fatalf("Expected [eu-1 us-1], got %v", names)
+		}
+
+		if names := listed(""); len(names) != 3 {
+			t.Fatalf("Expected every secret, got %v", names)
+		}
+
+		_, err := client.List(ctx, &infrapb.ListRequest{LabelSelector: "game in foo"})
+
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected an invalid argument error, got %v", err)
+		}
+	})
+
+	t.Run("labels are merged on update", func(t *testing.T) {
+		res, err := client.Update(ctx, &infrapb.Secret{Name: "us-1", Labels: map[string]string{"tier": "2"}, RemoveLabels: []string{"region"}})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		expected := map[string]string{"game": "foo", "tier": "2"}
+
+		if !reflect.DeepEqual(res.Labels, expected) {
+			t.Fatalf("Expected labels %v, got %v", expected, res.Labels)
+		}
+
+		if names := listed("game=foo,!region"); !reflect.DeepEqual(names, []string{"us-1"}) {
+			t.Fatalf("Expected [us-1], got %v", names)
+		}
+	})
+
+	t.Run("invalid labels", func(t *testing.T) {
+		tests := map[string]*infrapb.Secret{
+			"invalid key":   {Name: "invalid", Labels: map[string]string{"not a key": "foo"}},
+			"invalid value": {Name: "invalid", Labels: map[string]string{"game": "not a value"}},
+			"reserved key":  {Name: "invalid", Labels: map[string]string{reservedLabelPrefix + "namespace": "foo"}},
+			"managed by":    {Name: "invalid", Labels: map[string]string{kubernetesManagedByLabel: "foo"}},
+		}
+
+		for name, secret := range tests {
+			t.Run(name, func(t *testing.T) {
+				if _, err := client.Create(ctx, secret); status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expected an invalid argument error, got %v", err)
+				}
+			})
+		}
+
+		_, err := client.Update(ctx, &infrapb.Secret{Name: "eu-1", Labels: map[string]string{"game": "foo"}, RemoveLabels: []string{"game"}})
+
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected an invalid argument error, got %v", err)
+		}
+	})
+}
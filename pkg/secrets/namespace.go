@@ -0,0 +1,155 @@
+package secrets
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// namespaceMaxLength is the maximum length of a DNS label (RFC 1123), which is what a namespace
+// looks like.
+const namespaceMaxLength = 63
+
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// NamespaceConfig overrides the service's defaults for the secrets of a namespace. The fields left
+// to their zero value keep the service's ones.
+type NamespaceConfig struct {
+	TTL time.Duration
+
+	Issuer   string
+	Audience []string
+
+	// Algorithm, SigningKey, PrivateKey, KeyID and Keyring describe the key signing the tokens of
+	// the namespace, as for the service (see Config). The service's key is used if neither
+	// SigningKey, PrivateKey nor Keyring is set.
+	Algorithm  string
+	SigningKey []byte
+	PrivateKey []byte
+	KeyID      string
+	Keyring    *Keyring
+}
+
+// namespaceSettings are the settings applied to the secrets of a namespace, the service's ones
+// unless they are overridden by the namespace's configuration.
+type namespaceSettings struct {
+	ttl            time.Duration
+	issuer         string
+	audience       []string
+	keyring        *Keyring
+	reservedClaims []string
+}
+
+// checkNamespace checks that a namespace is either the default one, or a valid DNS label, so that
+// it can be used as is in the keys of the stores and in Kubernetes labels.
+func checkNamespace(namespace string) error {
+	if namespace == "" {
+		return nil
+	}
+
+	if len(namespace) > namespaceMaxLength || !namespacePattern.MatchString(namespace) {
+		return fmt.Errorf("namespace \"%s\" should be at most %d lowercase alphanumeric characters or \"-\", starting and ending with an alphanumeric character", namespace, namespaceMaxLength)
+	}
+
+	return nil
+}
+
+// newNamespaceSettings resolves the settings of a namespace, the config being the service's one
+// with its defaults already set.
+func newNamespaceSettings(config Config, namespace NamespaceConfig) (namespaceSettings, error) {
+	settings := namespaceSettings{
+		ttl:      config.TTL,
+		issuer:   config.Issuer,
+		audience: config.Audience,
+		keyring:  config.Keyring,
+	}
+
+	if namespace.TTL != 0 {
+		settings.ttl = namespace.TTL
+	}
+
+	if namespace.Issuer != "" {
+		settings.issuer = namespace.Issuer
+	}
+
+	if len(namespace.Audience) > 0 {
+		settings.audience = namespace.Audience
+	}
+
+	switch {
+	case namespace.Keyring != nil:
+		settings.keyring = namespace.Keyring
+
+	case len(namespace.SigningKey) > 0 || len(namespace.PrivateKey) > 0:
+		keyConfig := Config{
+			Algorithm:  namespace.Algorithm,
+			SigningKey: namespace.SigningKey,
+			PrivateKey: namespace.PrivateKey,
+			KeyID:      namespace.KeyID,
+		}
+
+		if keyConfig.Algorithm == "" {
+			keyConfig.Algorithm = config.Algorithm
+		}
+
+		keyring, err := newConfigKeyring(keyConfig)
+
+		if err != nil {
+			return namespaceSettings{}, err
+		}
+
+		settings.keyring = keyring
+	}
+
+	settings.reservedClaims = append(settings.reservedClaims, serviceClaims...)
+
+	if settings.issuer != "" {
+		settings.reservedClaims = append(settings.reservedClaims, "iss")
+	}
+
+	if len(settings.audience) > 0 {
+		settings.reservedClaims = append(settings.reservedClaims, "aud")
+	}
+
+	settings.reservedClaims = append(settings.reservedClaims, config.ReservedClaims...)
+
+	return settings, nil
+}
+
+// namespace returns the settings of a namespace.
+func (s *Service) namespace(namespace string) namespaceSettings {
+	if settings, ok := s.namespaces[namespace]; ok {
+		return settings
+	}
+
+	return s.defaults
+}
+
+// keyrings returns every keyring used by the service, without duplicates.
+func (s *Service) keyrings() []*Keyring {
+	keyrings := []*Keyring{s.keyring}
+	namespaces := make([]string, 0, len(s.namespaces))
+
+	for namespace := range s.namespaces {
+		namespaces = append(namespaces, namespace)
+	}
+
+	// the namespaces are sorted, so that the keys are always listed in the same order
+	sort.Strings(namespaces)
+
+	for _, namespace := range namespaces {
+		settings := s.namespaces[namespace]
+		found := false
+
+		for _, keyring := range keyrings {
+			found = found || keyring == settings.keyring
+		}
+
+		if !found {
+			keyrings = append(keyrings, settings.keyring)
+		}
+	}
+
+	return keyrings
+}
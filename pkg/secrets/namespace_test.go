@@ -0,0 +1,159 @@
+package secrets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"github.com/golang-jwt/jwt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNamespaces(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnectionWithConfig(t, store, Config{
+		SigningKey: []byte(testSigningKey),
+		Issuer:     "secrets",
+		Namespaces: map[string]NamespaceConfig{
+			"game": {
+				TTL:        2 * time.Hour,
+				Issuer:     "game-secrets",
+				Audience:   []string{"game-servers"},
+				Algorithm:  "ES256",
+				PrivateKey: generateTestPrivateKey(t, "ES256"),
+				KeyID:      "game",
+			},
+		},
+	})
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+
+	for _, namespace := range []string{"", "game", "chat"} {
+		if _, err := client.Create(ctx, &infrapb.Secret{Namespace: namespace, Name: "foo", Claims: map[string]string{"Foo": namespace}}); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+	}
+
+	t.Run("secrets are scoped by namespace", func(t *testing.T) {
+		details, err := client.Get(ctx, &infrapb.SecretRef{Namespace: "chat", Name: "foo"})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if details.Namespace != "chat" || details.Claims["Foo"] != "chat" {
+			t.Fatalf("Expected the secret of the namespace, got %v", details)
+		}
+
+		list, _ := client.List(ctx, &infrapb.ListRequest{Namespace: "game"})
+
+		if len(list.Secrets) != 1 || list.Secrets[0].Namespace != "game" {
+			t.Fatalf("Expected the secrets of the namespace, got %v", list.Secrets)
+		}
+
+		if list, _ := client.List(ctx, &infrapb.ListRequest{AllNamespaces: true}); len(list.Secrets) != 3 {
+			t.Fatalf("Expected the secrets of every namespace, got %v", list.Secrets)
+		}
+
+		if _, err := client.Get(ctx, &infrapb.SecretRef{Namespace: "other", Name: "foo"}); status.Code(err) != codes.NotFound {
+			t.Fatalf("Expected a not found error, got %v", err)
+		}
+	})
+
+	t.Run("namespace settings", func(t *testing.T) {
+		settings := conn.service.namespace("game")
+		secret, _ := store.Fetch(ctx, "game", "foo")
+		token, err := parseToken(secret.Token, settings.keyring.keyfunc)
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		claims := token.Claims.(jwt.MapClaims)
+
+		if token.Header["kid"] != "game" || claims["iss"] != "game-secrets" || claims["aud"] != "game-servers" || claims["namespace"] != "game" {
+			t.Fatalf("Expected the token to be issued with the settings of the namespace, got %v %v", token.Header, claims)
+		}
+
+		if until := time.Until(secret.ExpiresAt); until < time.Hour || until > 2*time.Hour {
+			t.Fatalf("Expected the ttl of the namespace, got %s", until)
+		}
+
+		secret, _ = store.Fetch(ctx, "chat", "foo")
+		token, err = parseToken(secret.Token, conn.service.keyring.keyfunc)
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if claims := token.Claims.(jwt.MapClaims); claims["iss"] != "secrets" || claims["namespace"] != "chat" {
+			t.Fatalf("Expected the token to be issued with the service's settings, got %v", claims)
+		}
+
+		secret, _ = store.Fetch(ctx, "", "foo")
+		token, _ = parseToken(secret.Token, conn.service.keyring.keyfunc)
+
+		if _, ok := token.Claims.(jwt.MapClaims)["namespace"]; ok {
+			t.Fatal("Expected no namespace claim for the default namespace")
+		}
+	})
+
+	t.Run("introspection", func(t *testing.T) {
+		secret, _ := store.Fetch(ctx, "game", "foo")
+		res, err := client.Introspect(ctx, &infrapb.IntrospectRequest{Token: secret.Token})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if !res.Active || res.Namespace != "game" || res.Name != "foo" {
+			t.Fatalf("Expected an active token of secret \"game/foo\", got %v", res)
+		}
+
+		// a token claiming to be of a namespace must be signed with its key
+		forged, _ := createToken("foo", map[string]interface{}{"namespace": "game", "exp": time.Now().Add(time.Hour).Unix()}, conn.service.keyring.Active())
+
+		if res, _ := client.Introspect(ctx, &infrapb.IntrospectRequest{Token: forged}); res.Active {
+			t.Fatalf("Expected a token signed with another key to be inactive, got %v", res)
+		}
+	})
+
+	t.Run("jwks", func(t *testing.T) {
+		res, err := client.GetJWKS(ctx, &infrapb.Empty{})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if len(res.Keys) != 1 || res.Keys[0].Kid != "game" {
+			t.Fatalf("Expected the public key of the namespace, got %v", res.Keys)
+		}
+	})
+
+	t.Run("invalid namespace", func(t *testing.T) {
+		for _, namespace := range []string{"Game", "-game", "game/foo"} {
+			_, err := client.Create(ctx, &infrapb.Secret{Namespace: namespace, Name: "foo"})
+
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Expected an invalid argument error for \"%s\", got %v", namespace, err)
+			}
+		}
+
+		_, err := client.Create(ctx, &infrapb.Secret{Namespace: "chat", Name: "bar", Claims: map[string]string{"namespace": "game"}})
+
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected the namespace claim to be reserved, got %v", err)
+		}
+	})
+
+	if _, err := NewService(store, Config{Namespaces: map[string]NamespaceConfig{"Not Valid": {}}}); err == nil {
+		t.Fatal("Expected an error for an invalid configured namespace")
+	}
+}
@@ -0,0 +1,108 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// pageToken is the position of the last secret of a page, given to the client to list the next
+// page. It also holds the order and the filters of the listing, as the position is meaningless for
+// another listing.
+type pageToken struct {
+	OrderBy   ListOrder `json:"o"`
+	Filter    string    `json:"f"`
+	Namespace string    `json:"ns,omitempty"`
+	Name      string    `json:"n"`
+	ExpiresAt int64     `json:"e"`
+}
+
+// listPage returns the page of the secrets asked by a List request.
+func listPage(in *infrapb.ListRequest) (PageOptions, error) {
+	page := PageOptions{Size: int(in.PageSize)}
+
+	switch in.OrderBy {
+	case infrapb.ListRequest_NAME:
+		page.OrderBy = OrderByName
+
+	case infrapb.ListRequest_EXPIRY:
+		page.OrderBy = OrderByExpiry
+
+	default:
+		return PageOptions{}, fmt.Errorf("unknown order %d", in.OrderBy)
+	}
+
+	switch {
+	case page.Size < 0:
+		return PageOptions{}, fmt.Errorf("page size %d is negative", page.Size)
+
+	case page.Size == 0:
+		page.Size = defaultPageSize
+
+	case page.Size > maxPageSize:
+		page.Size = maxPageSize
+	}
+
+	if in.PageToken == "" {
+		return page, nil
+	}
+
+	token, err := decodePageToken(in.PageToken)
+
+	if err != nil {
+		return PageOptions{}, err
+	}
+
+	if token.OrderBy != page.OrderBy || token.Filter != listFilter(in) {
+		return PageOptions{}, errors.New("page token was given for another listing")
+	}
+
+	page.After = &PageCursor{
+		Namespace: token.Namespace,
+		Name:      token.Name,
+		ExpiresAt: fromUnixNano(token.ExpiresAt),
+	}
+
+	return page, nil
+}
+
+// listFilter identifies the secrets listed by a request, whatever the page.
+func listFilter(in *infrapb.ListRequest) string {
+	return fmt.Sprintf("%s\x00%t\x00%s", in.Namespace, in.AllNamespaces, in.LabelSelector)
+}
+
+func encodePageToken(in *infrapb.ListRequest, page PageOptions, last Secret) string {
+	token, _ := json.Marshal(pageToken{
+		OrderBy:   page.OrderBy,
+		Filter:    listFilter(in),
+		Namespace: last.Namespace,
+		Name:      last.Name,
+		ExpiresAt: unixNano(last.ExpiresAt),
+	})
+
+	return encodeBase64(token)
+}
+
+func decodePageToken(encoded string) (pageToken, error) {
+	var token pageToken
+
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+
+	if err == nil {
+		err = json.Unmarshal(decoded, &token)
+	}
+
+	if err != nil {
+		return pageToken{}, fmt.Errorf("invalid page token : %w", err)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,102 @@
+package secrets
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestPagination(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+
+	for i := 0; i < 5; i++ {
+		if _, err := client.Create(ctx, &infrapb.Secret{Name: fmt.Sprintf("s-%d", i), Ttl: durationpb.New(time.Duration(6-i) * time.Hour)}); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+	}
+
+	// listed lists every page of the secrets, returning their names and the number of pages
+	listed := func(in *infrapb.ListRequest) ([]string, int) {
+		var names []string
+
+		for pages := 1; ; pages++ {
+			res, err := client.List(ctx, in)
+
+			if err != nil {
+				t.Fatalf("Unexpected error : %s", err)
+			}
+
+			for _, secret := range res.Secrets {
+				names = append(names, secret.Name)
+			}
+
+			if res.NextPageToken == "" {
+				return names, pages
+			}
+
+			in.PageToken = res.NextPageToken
+		}
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		names, pages := listed(&infrapb.ListRequest{PageSize: 2})
+		expected := []string{"s-0", "s-1", "s-2", "s-3", "s-4"}
+
+		if !reflect.DeepEqual(names, expected) || pages != 3 {
+			t.Fatalf("Expected %v in 3 pages, got %v in %d pages", expected, names, pages)
+		}
+
+		// a full last page has no next page
+		if _, pages := listed(&infrapb.ListRequest{PageSize: 5}); pages != 1 {
+			t.Fatalf("Expected a single page, got %d", pages)
+		}
+
+		if _, pages := listed(&infrapb.ListRequest{}); pages != 1 {
+			t.Fatalf("Expected a single page of the default size, got %d", pages)
+		}
+	})
+
+	t.Run("order by expiry", func(t *testing.T) {
+		names, _ := listed(&infrapb.ListRequest{PageSize: 2, OrderBy: infrapb.ListRequest_EXPIRY})
+		expected := []string{"s-4", "s-3", "s-2", "s-1", "s-0"}
+
+		if !reflect.DeepEqual(names, expected) {
+			t.Fatalf("Expected %v, got %v", expected, names)
+		}
+	})
+
+	t.Run("invalid page", func(t *testing.T) {
+		res, _ := client.List(ctx, &infrapb.ListRequest{PageSize: 2})
+
+		tests := map[string]*infrapb.ListRequest{
+			"negative size": {PageSize: -1},
+			"unknown order": {OrderBy: 42},
+			"invalid token": {PageToken: "not a token"},
+			"other order":   {PageSize: 2, PageToken: res.NextPageToken, OrderBy: infrapb.ListRequest_EXPIRY},
+			"other filter":  {PageSize: 2, PageToken: res.NextPageToken, LabelSelector: "game=foo"},
+		}
+
+		for name, in := range tests {
+			t.Run(name, func(t *testing.T) {
+				if _, err := client.List(ctx, in); status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expected an invalid argument error, got %v", err)
+				}
+			})
+		}
+	})
+}
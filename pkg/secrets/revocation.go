@@ -0,0 +1,357 @@
+package secrets
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"github.com/golang-jwt/jwt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// errTokenNotFound is returned when revoking a token which is not one of the secret's.
+var errTokenNotFound = errors.New("no such token")
+
+// RevokedToken is a token which must not be accepted anymore, even though it is not expired.
+type RevokedToken struct {
+	// ID is the "jti" claim of the token.
+	ID        string
+	Namespace string
+	Name      string
+	ExpiresAt time.Time
+	RevokedAt time.Time
+}
+
+// RevocationList keeps the revoked tokens until they expire, as they are rejected anyway once
+// expired.
+type RevocationList interface {
+	Revoke(context.Context, RevokedToken) error
+	Contains(context.Context, string) (bool, error)
+
+	// List returns the revoked tokens which are not expired yet.
+	List(context.Context) ([]RevokedToken, error)
+}
+
+// RevocationStore is implemented by the secret stores able to keep the revoked tokens along with
+// the secrets, so that the revocations survive restarts and are shared by every replica using the
+// same store.
+type RevocationStore interface {
+	Revocations() RevocationList
+}
+
+type revocationList struct {
+	tokens map[string]RevokedToken
+	lock   sync.Mutex
+}
+
+// NewRevocationList creates an in memory revocation list.
+func NewRevocationList() RevocationList {
+	return &revocationList{
+		tokens: make(map[string]RevokedToken),
+	}
+}
+
+// storeRevocations returns the revocation list kept by the store, or an in memory one if the store
+// can't keep it. The revocations would then be lost on restart, while the secrets are not.
+func storeRevocations(store SecretStore) RevocationList {
+	if store, ok := store.(RevocationStore); ok {
+		return store.Revocations()
+	}
+
+	if _, ok := store.(*secretStore); !ok {
+		log.Println("The store can't keep the revoked tokens, they are kept in memory : they will be accepted again once the service restarts.")
+	}
+
+	return NewRevocationList()
+}
+
+func (l *revocationList) Revoke(ctx context.Context, token RevokedToken) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.purge()
+	l.tokens[token.ID] = token
+
+	return nil
+}
+
+func (l *revocationList) Contains(ctx context.Context, id string) (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	token, exists := l.tokens[id]
+
+	return exists && token.ExpiresAt.After(time.Now()), nil
+}
+
+func (l *revocationList) List(ctx context.Context) ([]RevokedToken, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.purge()
+	result := make([]RevokedToken, 0, len(l.tokens))
+
+	for _, token := range l.tokens {
+		result = append(result, token)
+	}
+
+	sortRevokedTokens(result)
+
+	return result, nil
+}
+
+// purge forgets the expired tokens.
+func (l *revocationList) purge() {
+	now := time.Now()
+
+	for id, token := range l.tokens {
+		if !token.ExpiresAt.After(now) {
+			delete(l.tokens, id)
+		}
+	}
+}
+
+// sortRevokedTokens sorts the revoked tokens by revocation date, as returned by List.
+func sortRevokedTokens(tokens []RevokedToken) {
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].RevokedAt.Before(tokens[j].RevokedAt)
+	})
+}
+
+// revocationFeed sends the revoked tokens to its subscribers as they are revoked. Subscribers
+// too slow to receive them are dropped, their channel being closed.
+type revocationFeed struct {
+	lock        sync.Mutex
+	subscribers map[chan RevokedToken]struct{}
+}
+
+func newRevocationFeed() *revocationFeed {
+	return &revocationFeed{
+		subscribers: make(map[chan RevokedToken]struct{}),
+	}
+}
+
+func (f *revocationFeed) publish(token RevokedToken) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for subscriber := range f.subscribers {
+		select {
+		case subscriber <- token:
+		default:
+			f.unsubscribe(subscriber)
+		}
+	}
+}
+
+func (f *revocationFeed) subscribe() chan RevokedToken {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	subscriber := make(chan RevokedToken, subscriptionBufferSize)
+	f.subscribers[subscriber] = struct{}{}
+
+	return subscriber
+}
+
+func (f *revocationFeed) unsubscribe(subscriber chan RevokedToken) {
+	if _, ok := f.subscribers[subscriber]; !ok {
+		return
+	}
+
+	delete(f.subscribers, subscriber)
+	close(subscriber)
+}
+
+func (f *revocationFeed) close(subscriber chan RevokedToken) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.unsubscribe(subscriber)
+}
+
+// Revoke revokes a token of a secret : the current one if no jti is given, or one of its previous
+// versions. As the current token can't be used anymore, a new one is issued in its place.
+func (s *Service) Revoke(ctx context.Context, in *infrapb.RevokeRequest) (*infrapb.RevokedToken, error) {
+	secret, err := s.store.Fetch(ctx, in.Namespace, in.Name)
+
+	if errors.Is(err, ErrSecretNotFound) {
+		return &infrapb.RevokedToken{}, status.Errorf(codes.NotFound, "secret name \"%s\" doesn't exists", in.Name)
+	}
+
+	if err != nil {
+		return &infrapb.RevokedToken{}, status.Errorf(codes.Internal, "couldn't fetch secret : %s", err)
+	}
+
+	revoked, current, err := findToken(secret, in.Jti)
+
+	if errors.Is(err, errTokenNotFound) {
+		return &infrapb.RevokedToken{}, status.Errorf(codes.NotFound, "token \"%s\" of secret name \"%s\" doesn't exists", in.Jti, in.Name)
+	}
+
+	if err != nil {
+		return &infrapb.RevokedToken{}, status.Errorf(codes.FailedPrecondition, "couldn't read token : %s", err)
+	}
+
+	if err := s.revocations.Revoke(ctx, revoked); err != nil {
+		return &infrapb.RevokedToken{}, status.Errorf(codes.Internal, "couldn't revoke token : %s", err)
+	}
+
+	s.revocationFeed.publish(revoked)
+
+	if current {
+		if _, err := s.renewSecret(ctx, s.namespace(secret.Namespace).keyring, secret, 0, time.Time{}); err != nil {
+			return newRevokedToken(revoked), status.Errorf(codes.Internal, "token revoked, but couldn't issue a new one : %s", err)
+		}
+	}
+
+	return newRevokedToken(revoked), nil
+}
+
+func (s *Service) ListRevoked(ctx context.Context, in *infrapb.Empty) (*infrapb.RevokedTokenList, error) {
+	revoked, err := s.revocations.List(ctx)
+
+	if err != nil {
+		return &infrapb.RevokedTokenList{}, status.Errorf(codes.Internal, "couldn't retrieve list of revoked tokens : %s", err)
+	}
+
+	tokens := make([]*infrapb.RevokedToken, 0, len(revoked))
+
+	for _, token := range revoked {
+		tokens = append(tokens, newRevokedToken(token))
+	}
+
+	return &infrapb.RevokedTokenList{Tokens: tokens}, nil
+}
+
+func (s *Service) WatchRevoked(in *infrapb.Empty, stream infrapb.Secrets_WatchRevokedServer) error {
+	// subscribing first ensures no token revoked while listing is missed
+	subscriber := s.revocationFeed.subscribe()
+	defer s.revocationFeed.close(subscriber)
+
+	revoked, err := s.revocations.List(stream.Context())
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "couldn't retrieve list of revoked tokens : %s", err)
+	}
+
+	for _, token := range revoked {
+		if err := stream.Send(newRevokedToken(token)); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+
+		case token, ok := <-subscriber:
+			if !ok {
+				return status.Errorf(codes.ResourceExhausted, "watch interrupted : %s", ErrSubscriptionOverflow)
+			}
+
+			if err := stream.Send(newRevokedToken(token)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// recordIssuedToken keeps the jti and expiration date of the secret's current token, forgetting the
+// tokens issued before it which are expired.
+func recordIssuedToken(secret *Secret) {
+	now := time.Now()
+	var tokens []IssuedToken
+
+	for _, token := range secret.IssuedTokens {
+		if token.ExpiresAt.After(now) {
+			tokens = append(tokens, token)
+		}
+	}
+
+	if id, expiresAt, err := readTokenID(secret.Token); err == nil {
+		tokens = append(tokens, IssuedToken{ID: id, ExpiresAt: expiresAt})
+	}
+
+	secret.IssuedTokens = tokens
+}
+
+// findToken finds the token of a secret with the given jti, the current one if the jti is empty,
+// telling whether it is the current one.
+func findToken(secret Secret, id string) (RevokedToken, bool, error) {
+	currentID, expiresAt, err := readTokenID(secret.Token)
+
+	if id == "" && err != nil {
+		return RevokedToken{}, false, err
+	}
+
+	current := err == nil && (id == "" || id == currentID)
+
+	for i := len(secret.IssuedTokens) - 1; !current && i >= 0; i-- {
+		if issued := secret.IssuedTokens[i]; issued.ID == id {
+			return RevokedToken{ID: id, Namespace: secret.Namespace, Name: secret.Name, ExpiresAt: issued.ExpiresAt, RevokedAt: time.Now()}, false, nil
+		}
+	}
+
+	// the secrets saved before the issued tokens were kept only have the tokens of their versions
+	for i := len(secret.History) - 1; !current && i >= 0; i-- {
+		if versionID, versionExpiresAt, err := readTokenID(secret.History[i].Token); err == nil && versionID == id {
+			return RevokedToken{ID: id, Namespace: secret.Namespace, Name: secret.Name, ExpiresAt: versionExpiresAt, RevokedAt: time.Now()}, false, nil
+		}
+	}
+
+	if !current {
+		return RevokedToken{}, false, errTokenNotFound
+	}
+
+	return RevokedToken{ID: currentID, Namespace: secret.Namespace, Name: secret.Name, ExpiresAt: expiresAt, RevokedAt: time.Now()}, true, nil
+}
+
+// readTokenID returns the "jti" and "exp" claims of a token issued by the service. As it was
+// issued by the service, the token is not verified.
+func readTokenID(token string) (string, time.Time, error) {
+	claims := jwt.MapClaims{}
+
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		return "", time.Time{}, err
+	}
+
+	id, _ := claims["jti"].(string)
+
+	if id == "" {
+		return "", time.Time{}, errors.New("token has no \"jti\" claim")
+	}
+
+	exp, _ := claims["exp"].(float64)
+
+	return id, time.Unix(int64(exp), 0), nil
+}
+
+// newTokenID generates a unique "jti" claim for a token.
+func newTokenID() string {
+	id := make([]byte, 16)
+
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+
+	return encodeBase64(id)
+}
+
+func newRevokedToken(token RevokedToken) *infrapb.RevokedToken {
+	return &infrapb.RevokedToken{
+		Jti:       token.ID,
+		Namespace: token.Namespace,
+		Name:      token.Name,
+		ExpiresAt: timestamppb.New(token.ExpiresAt),
+		RevokedAt: timestamppb.New(token.RevokedAt),
+	}
+}
@@ -0,0 +1,203 @@
+package secrets
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRevoke(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+	client.Create(ctx, &infrapb.Secret{Name: "foo"})
+
+	created, _ := store.Fetch(ctx, "", "foo")
+	createdID, _, err := readTokenID(created.Token)
+
+	if err != nil {
+		t.Fatalf("Issued tokens should have a jti : %s", err)
+	}
+
+	t.Run("current token", func(t *testing.T) {
+		res, err := client.Revoke(ctx, &infrapb.RevokeRequest{Name: "foo"})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if res.Jti != createdID || res.Name != "foo" || !res.ExpiresAt.AsTime().Equal(time.Unix(created.ExpiresAt.Unix(), 0)) {
+			t.Fatalf("Expected the current token to be revoked, got %v", res)
+		}
+
+		if revoked, _ := conn.service.revocations.Contains(ctx, createdID); !revoked {
+			t.Fatal("Token should be in the revocation list")
+		}
+
+		secret, _ := store.Fetch(ctx, "", "foo")
+
+		if id, _, _ := readTokenID(secret.Token); id == createdID {
+			t.Fatal("A new token should have been issued in place of the revoked one")
+		}
+	})
+
+	t.Run("previous token", func(t *testing.T) {
+		client.Update(ctx, &infrapb.Secret{Name: "foo", Claims: map[string]string{"Foo": "bar"}})
+		previous, _ := store.Fetch(ctx, "", "foo")
+		previousID, _, _ := readTokenID(previous.Token)
+
+		client.Update(ctx, &infrapb.Secret{Name: "foo", Claims: map[string]string{"Foo": "baz"}})
+
+		if _, err := client.Revoke(ctx, &infrapb.RevokeRequest{Name: "foo", Jti: previousID}); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if secret, _ := store.Fetch(ctx, "", "foo"); secret.Revision != previous.Revision+1 {
+			t.Fatal("No new token should be issued when revoking a previous one")
+		}
+
+		res, _ := client.ListRevoked(ctx, &infrapb.Empty{})
+
+		if len(res.Tokens) != 2 || res.Tokens[0].Jti != createdID || res.Tokens[1].Jti != previousID {
+			t.Fatalf("Expected both tokens to be listed as revoked, got %v", res.Tokens)
+		}
+	})
+
+	t.Run("renewed token", func(t *testing.T) {
+		renewed, _ := store.Fetch(ctx, "", "foo")
+		renewedID, _, _ := readTokenID(renewed.Token)
+
+		if _, err := client.Renew(ctx, &infrapb.RenewRequest{Name: "foo"}); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		// the renewal is not a version, but its previous token is still valid until it expires
+		if _, err := client.Revoke(ctx, &infrapb.RevokeRequest{Name: "foo", Jti: renewedID}); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if revoked, _ := conn.service.revocations.Contains(ctx, renewedID); !revoked {
+			t.Fatal("Token should be in the revocation list")
+		}
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		_, err := client.Revoke(ctx, &infrapb.RevokeRequest{Name: "foo", Jti: "unknown"})
+
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Expected a NotFound error, got %v", err)
+		}
+
+		_, err = client.Revoke(ctx, &infrapb.RevokeRequest{Name: "not existing"})
+
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Expected a NotFound error, got %v", err)
+		}
+	})
+}
+
+func TestWatchRevoked(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+	client.Create(ctx, &infrapb.Secret{Name: "foo"})
+	client.Create(ctx, &infrapb.Secret{Name: "bar"})
+	client.Revoke(ctx, &infrapb.RevokeRequest{Name: "foo"})
+
+	stream, err := client.WatchRevoked(ctx, &infrapb.Empty{})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if token, err := stream.Recv(); err != nil || token.Name != "foo" {
+		t.Fatalf("Expected the already revoked token first, got %v (%v)", token, err)
+	}
+
+	client.Revoke(ctx, &infrapb.RevokeRequest{Name: "bar"})
+
+	if token, err := stream.Recv(); err != nil || token.Name != "bar" {
+		t.Fatalf("Expected the newly revoked token, got %v (%v)", token, err)
+	}
+}
+
+func TestRevocationList(t *testing.T) {
+	testRevocationList(t, NewRevocationList())
+}
+
+func TestRevocationsKeptByTheStore(t *testing.T) {
+	ctx := context.TODO()
+	store := newTestSQLSecretStore(t, filepath.Join(t.TempDir(), "secrets.db"))
+	services := make([]*Service, 2)
+
+	for i := range services {
+		service, err := NewService(store, Config{SigningKey: []byte(testSigningKey)})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		services[i] = service
+	}
+
+	services[0].revocations.Revoke(ctx, RevokedToken{ID: "foo", ExpiresAt: time.Now().Add(time.Hour)})
+
+	if revoked, _ := services[1].revocations.Contains(ctx, "foo"); !revoked {
+		t.Fatal("Expected the revoked token to be shared by the services using the same store")
+	}
+}
+
+// testRevocationList checks the behavior expected from every RevocationList.
+func testRevocationList(t *testing.T, revocations RevocationList) {
+	ctx := context.TODO()
+	revokedAt := time.Now().Add(-time.Minute)
+
+	revocations.Revoke(ctx, RevokedToken{ID: "expired", ExpiresAt: time.Now().Add(-time.Minute), RevokedAt: revokedAt})
+	revocations.Revoke(ctx, RevokedToken{ID: "last", Namespace: "game", Name: "foo", ExpiresAt: time.Now().Add(time.Hour), RevokedAt: revokedAt.Add(2 * time.Second)})
+	revocations.Revoke(ctx, RevokedToken{ID: "first", Name: "foo", ExpiresAt: time.Now().Add(time.Hour), RevokedAt: revokedAt.Add(time.Second)})
+
+	if revoked, _ := revocations.Contains(ctx, "expired"); revoked {
+		t.Fatal("Expired tokens don't need to be revoked")
+	}
+
+	if revoked, _ := revocations.Contains(ctx, "unknown"); revoked {
+		t.Fatal("Unknown tokens should not be revoked")
+	}
+
+	if revoked, err := revocations.Contains(ctx, "first"); err != nil || !revoked {
+		t.Fatalf("Expected the token to be revoked, got %v (%v)", revoked, err)
+	}
+
+	tokens, err := revocations.List(ctx)
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if len(tokens) != 2 || tokens[0].ID != "first" || tokens[1].ID != "last" {
+		t.Fatalf("Expected only the valid tokens to be listed by revocation date, got %v", tokens)
+	}
+
+	if token := tokens[1]; token.Namespace != "game" || token.Name != "foo" || !token.RevokedAt.Equal(revokedAt.Add(2*time.Second)) {
+		t.Fatalf("Expected the revoked token to be kept as is, got %v", token)
+	}
+}
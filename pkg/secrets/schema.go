@@ -0,0 +1,348 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ClaimsSchema describes the claims a secret can have, as the subset of JSON Schema listed below.
+// The schema of the claims is an object one : each claim is described by one of its properties.
+type ClaimsSchema struct {
+	// Annotations, which are not checked.
+	Schema      string `json:"$schema"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+
+	Type schemaTypes   `json:"type"`
+	Enum []interface{} `json:"enum"`
+
+	// Strings.
+	MinLength *int   `json:"minLength"`
+	MaxLength *int   `json:"maxLength"`
+	Pattern   string `json:"pattern"`
+
+	// Numbers.
+	Minimum *float64 `json:"minimum"`
+	Maximum *float64 `json:"maximum"`
+
+	// Arrays.
+	Items *ClaimsSchema `json:"items"`
+
+	// Objects.
+	Properties           map[string]*ClaimsSchema `json:"properties"`
+	Required             []string                 `json:"required"`
+	AdditionalProperties *bool                    `json:"additionalProperties"`
+
+	pattern *regexp.Regexp
+}
+
+// ParseClaimsSchema parses a JSON encoded claims schema. The keywords which are not supported are
+// rejected, rather than silently not being enforced.
+func ParseClaimsSchema(data []byte) (*ClaimsSchema, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	schema := &ClaimsSchema{}
+
+	if err := decoder.Decode(schema); err != nil {
+		return nil, fmt.Errorf("couldn't decode claims schema : %w", err)
+	}
+
+	if err := schema.compile(); err != nil {
+		return nil, fmt.Errorf("invalid claims schema : %w", err)
+	}
+
+	return schema, nil
+}
+
+func (s *ClaimsSchema) compile() error {
+	for _, t := range s.Type {
+		switch t {
+		case "string", "number", "integer", "boolean", "array", "object", "null":
+		default:
+			return fmt.Errorf("unknown type \"%s\"", t)
+		}
+	}
+
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+
+		if err != nil {
+			return err
+		}
+
+		s.pattern = pattern
+	}
+
+	if s.Items != nil {
+		if err := s.Items.compile(); err != nil {
+			return err
+		}
+	}
+
+	for name, property := range s.Properties {
+		if property == nil {
+			return fmt.Errorf("property \"%s\" has no schema", name)
+		}
+
+		if err := property.compile(); err != nil {
+			return fmt.Errorf("property \"%s\" : %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// validate returns every violation of the schema by the claims.
+func (s *ClaimsSchema) validate(claims map[string]interface{}) []claimViolation {
+	if s == nil {
+		return nil
+	}
+
+	return s.validateValue("", claims)
+}
+
+func (s *ClaimsSchema) validateValue(path string, value interface{}) []claimViolation {
+	if claims, ok := value.(map[string]interface{}); ok {
+		return s.validateObject(path, claims)
+	}
+
+	if !s.hasType(value) {
+		return []claimViolation{{path, fmt.Sprintf("should be of type %s", strings.Join(s.Type, " or "))}}
+	}
+
+	var violations []claimViolation
+
+	if len(s.Enum) > 0 && !s.inEnum(value) {
+		violations = append(violations, claimViolation{path, "is not one of the allowed values"})
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+
+		if s.MinLength != nil && length < *s.MinLength {
+			violations = append(violations, claimViolation{path, fmt.Sprintf("should be at least %d characters long", *s.MinLength)})
+		}
+
+		if s.MaxLength != nil && length > *s.MaxLength {
+			violations = append(violations, claimViolation{path, fmt.Sprintf("should be at most %d characters long", *s.MaxLength)})
+		}
+
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			violations = append(violations, claimViolation{path, fmt.Sprintf("should match %s", s.Pattern)})
+		}
+
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				violations = append(violations, s.Items.validateValue(fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+	}
+
+	if number, ok := claimNumber(value); ok {
+		if s.Minimum != nil && number < *s.Minimum {
+			violations = append(violations, claimViolation{path, fmt.Sprintf("should be at least %v", *s.Minimum)})
+		}
+
+		if s.Maximum != nil && number > *s.Maximum {
+			violations = append(violations, claimViolation{path, fmt.Sprintf("should be at most %v", *s.Maximum)})
+		}
+	}
+
+	return violations
+}
+
+func (s *ClaimsSchema) validateObject(path string, object map[string]interface{}) []claimViolation {
+	if len(s.Type) > 0 && !s.allows("object") {
+		return []claimViolation{{path, fmt.Sprintf("should be of type %s", strings.Join(s.Type, " or "))}}
+	}
+
+	var violations []claimViolation
+
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			violations = append(violations, claimViolation{joinClaimPath(path, name), "is required"})
+		}
+	}
+
+	// the claims are sorted, so that the violations are always listed in the same order
+	names := make([]string, 0, len(object))
+
+	for name := range object {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := s.Properties[name]
+
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				violations = append(violations, claimViolation{joinClaimPath(path, name), "is not allowed"})
+			}
+
+			continue
+		}
+
+		violations = append(violations, property.validateValue(joinClaimPath(path, name), object[name])...)
+	}
+
+	return violations
+}
+
+func (s *ClaimsSchema) hasType(value interface{}) bool {
+	if len(s.Type) == 0 {
+		return true
+	}
+
+	switch value.(type) {
+	case nil:
+		return s.allows("null")
+
+	case string:
+		return s.allows("string")
+
+	case bool:
+		return s.allows("boolean")
+
+	case []interface{}:
+		return s.allows("array")
+	}
+
+	number, ok := claimNumber(value)
+
+	if !ok {
+		return false
+	}
+
+	return s.allows("number") || (s.allows("integer") && number == math.Trunc(number))
+}
+
+func (s *ClaimsSchema) allows(t string) bool {
+	for _, allowed := range s.Type {
+		if allowed == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *ClaimsSchema) inEnum(value interface{}) bool {
+	number, isNumber := claimNumber(value)
+
+	for _, allowed := range s.Enum {
+		if n, ok := claimNumber(allowed); ok && isNumber && n == number {
+			return true
+		}
+
+		if reflect.DeepEqual(allowed, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// schemaTypes is the "type" keyword, which is either a single type or a list of them.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+
+	var types []string
+
+	if err := json.Unmarshal(data, &types); err != nil {
+		return errors.New("type should be a string or an array of strings")
+	}
+
+	*t = types
+
+	return nil
+}
+
+// claimNumber returns the value of a numeric claim, which is a float64 once decoded from JSON or
+// from a Struct, but an int64 for the dates set by the service.
+func claimNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+
+	case int64:
+		return float64(v), true
+
+	case int:
+		return float64(v), true
+	}
+
+	return 0, false
+}
+
+func joinClaimPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+// claimViolation describes why a claim is not valid.
+type claimViolation struct {
+	claim       string
+	description string
+}
+
+// claimsError lists every violation of the claims given to a secret.
+type claimsError struct {
+	violations []claimViolation
+}
+
+func (e *claimsError) Error() string {
+	descriptions := make([]string, 0, len(e.violations))
+
+	for _, violation := range e.violations {
+		descriptions = append(descriptions, fmt.Sprintf("claim \"%s\" %s", violation.claim, violation.description))
+	}
+
+	return "invalid claims : " + strings.Join(descriptions, ", ")
+}
+
+// status returns an InvalidArgument error, detailing each violation for the clients able to read
+// them.
+func (e *claimsError) status() error {
+	st := status.New(codes.InvalidArgument, e.Error())
+	badRequest := &errdetails.BadRequest{}
+
+	for _, violation := range e.violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       "claims." + violation.claim,
+			Description: violation.description,
+		})
+	}
+
+	if detailed, err := st.WithDetails(badRequest); err == nil {
+		st = detailed
+	}
+
+	return st.Err()
+}
@@ -0,0 +1,161 @@
+package secrets
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const testClaimsSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"properties": {
+		"exp": {"type": "integer"},
+		"game": {"type": "string", "pattern": "^[a-z-]+$", "maxLength": 16},
+		"tier": {"type": "integer", "minimum": 1, "maximum": 3},
+		"region": {"enum": ["eu", "us"]},
+		"roles": {"type": "array", "items": {"type": "string", "enum": ["admin", "player"]}},
+		"limits": {
+			"type": "object",
+			"properties": {"players": {"type": "number"}},
+			"required": ["players"]
+		}
+	},
+	"required": ["game"],
+	"additionalProperties": false
+}`
+
+func TestParseClaimsSchema(t *testing.T) {
+	if _, err := ParseClaimsSchema([]byte(testClaimsSchema)); err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	tests := map[string]string{
+		"unsupported keyword": `{"properties": {"game": {"format": "hostname"}}}`,
+		"unknown type":        `{"properties": {"game": {"type": "text"}}}`,
+		"invalid pattern":     `{"properties": {"game": {"pattern": "("}}}`,
+		"not a schema":        `[]`,
+	}
+
+	for name, schema := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseClaimsSchema([]byte(schema)); err == nil {
+				t.Fatal("Expected an error, got none")
+			}
+		})
+	}
+}
+
+func TestClaimsSchema(t *testing.T) {
+	schema, _ := ParseClaimsSchema([]byte(testClaimsSchema))
+
+	tests := map[string]struct {
+		claims     map[string]interface{}
+		violations []string
+	}{
+		"valid": {
+			claims: map[string]interface{}{
+				"exp":    int64(4102444800),
+				"game":   "space-race",
+				"tier":   float64(2),
+				"region": "eu",
+				"roles":  []interface{}{"admin"},
+				"limits": map[string]interface{}{"players": float64(64)},
+			},
+		},
+		"missing claim": {
+			claims:     map[string]interface{}{},
+			violations: []string{"game"},
+		},
+		"unknown claim": {
+			claims:     map[string]interface{}{"game": "foo", "foo": "bar"},
+			violations: []string{"foo"},
+		},
+		"every violation": {
+			claims: map[string]interface{}{
+				"game":   "Space Race",
+				"tier":   1.5,
+				"region": "asia",
+				"roles":  []interface{}{"admin", "owner", float64(42)},
+				"limits": map[string]interface{}{},
+			},
+			violations: []string{"game", "limits.players", "region", "roles[1]", "roles[2]", "tier"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var claims []string
+
+			for _, violation := range schema.validate(test.claims) {
+				claims = append(claims, violation.claim)
+			}
+
+			if !reflect.DeepEqual(claims, test.violations) {
+				t.Fatalf("Expected violations of %v, got %v", test.violations, claims)
+			}
+		})
+	}
+}
+
+func TestClaimsValidation(t *testing.T) {
+	schema, _ := ParseClaimsSchema([]byte(testClaimsSchema))
+	store := NewSecretStore()
+	conn := newTestConnectionWithConfig(t, store, Config{SigningKey: []byte(testSigningKey), ClaimsSchema: schema, ReservedClaims: []string{"region"}})
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+	tier, _ := structpb.NewStruct(map[string]interface{}{"tier": 2})
+
+	if _, err := client.Create(ctx, &infrapb.Secret{Name: "foo", Claims: map[string]string{"game": "space-race"}, TypedClaims: tier}); err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	t.Run("every violation is listed", func(t *testing.T) {
+		_, err := client.Create(ctx, &infrapb.Secret{Name: "bar", Claims: map[string]string{"id": "foo", "region": "eu", "tier": "2"}})
+
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected an invalid argument error, got %v", err)
+		}
+
+		var fields []string
+
+		for _, detail := range status.Convert(err).Details() {
+			for _, violation := range detail.(*errdetails.BadRequest).FieldViolations {
+				fields = append(fields, violation.Field)
+			}
+		}
+
+		expected := []string{"claims.id", "claims.region", "claims.game", "claims.id", "claims.tier"}
+
+		if !reflect.DeepEqual(fields, expected) {
+			t.Fatalf("Expected violations of %v, got %v", expected, fields)
+		}
+	})
+
+	t.Run("updated claims are merged before being checked", func(t *testing.T) {
+		if _, err := client.Update(ctx, &infrapb.Secret{Name: "foo", Claims: map[string]string{"game": "moon-race"}}); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		_, err := client.Update(ctx, &infrapb.Secret{Name: "foo", Claims: map[string]string{"unknown": "claim"}})
+
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected an invalid argument error, got %v", err)
+		}
+
+		if secret, _ := store.Fetch(ctx, "", "foo"); secret.Claims["game"] != "moon-race" || secret.Claims["unknown"] != nil {
+			t.Fatalf("Expected the invalid update not to be saved, got %v", secret.Claims)
+		}
+	})
+}
@@ -2,237 +2,1161 @@ package secrets
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"strconv"
+	"path"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/Taluu/challenge-jwt/generated/infrapb"
 	"github.com/golang-jwt/jwt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 //go:generate protoc -I ../../ --go_out=../../. --go-grpc_out=../../. infra.proto
 
 const (
+	defaultAlgorithm      = "HS256"
+	defaultHistorySize    = 10
 	defaultNearTTL        = time.Hour
+	defaultRenewBatchSize = 1000
 	defaultTickerDuration = time.Second
 	defaultTTL            = 24 * time.Hour
+
+	// maxConflictRetries is the number of times a secret modified concurrently is fetched again
+	// before giving up on updating it.
+	maxConflictRetries = 10
+
+	// maxRenewBackoff is the longest the renewer waits before renewing again a secret which failed
+	// to be renewed.
+	maxRenewBackoff = 5 * time.Minute
 )
 
+// serviceClaims are set by the service on every token, and can't be given by the clients.
+var serviceClaims = []string{"id", "iat", "jti", "namespace"}
+
+// errSecretRenewed is used to skip the secrets renewed concurrently by the renewer.
+var errSecretRenewed = errors.New("secret was renewed in the meantime")
+
 type Config struct {
 	TTL          time.Duration
 	NearTTL      time.Duration
 	TickDuration time.Duration
 
+	// MinTTL and MaxTTL bound the validity period which can be given to a secret, if not zero.
+	MinTTL time.Duration
+	MaxTTL time.Duration
+
+	// MaxRenewBefore is the longest a secret can ask to be renewed before its expiration (NearTTL
+	// by default).
+	MaxRenewBefore time.Duration
+
+	// RenewBatchSize is the maximum number of secrets renewed on each tick.
+	RenewBatchSize int
+
+	// HistorySize is the number of versions kept for each secret.
+	HistorySize int
+
+	// Algorithm is the jwt algorithm used to sign the tokens (HS256 by default).
+	// For the HMAC ones (HS256, HS384, HS512), SigningKey is used as the shared secret. For the
+	// asymmetric ones (RS256, RS384, RS512, ES256, ES384, EdDSA), PrivateKey must be a PEM encoded
+	// private key matching the algorithm.
+	Algorithm  string
 	SigningKey []byte
+	PrivateKey []byte
+
+	// KeyID overrides the "kid" header of the tokens signed with the configured key.
+	KeyID string
+
+	// RetiredSigningKeys are the previous HMAC shared secrets, only used to verify the tokens they
+	// signed until those are renewed. They use Algorithm if it's an HMAC one, and HS256 otherwise.
+	RetiredSigningKeys []RetiredSigningKey
+
+	// Keyring, when set, is used instead of Algorithm, SigningKey, PrivateKey and KeyID. It allows
+	// to rotate the signing keys while still accepting the tokens signed by the retired ones.
+	Keyring *Keyring
+
+	// Issuer and Audience, when set, are the "iss" and "aud" claims of every token, overriding the
+	// ones of the secrets.
+	Issuer   string
+	Audience []string
+
+	// ClaimsSchema, when set, is enforced on the claims of the secrets when they are created or
+	// updated.
+	ClaimsSchema *ClaimsSchema
+
+	// ReservedClaims are claims the clients can't set, in addition to the "id", "iat", "jti" and
+	// "namespace" ones set by the service, and the "iss" and "aud" ones when Issuer and Audience are
+	// configured.
+	ReservedClaims []string
+
+	// Namespaces overrides the ttl, issuer, audience and signing key of the secrets of some
+	// namespaces. The other namespaces use the settings above.
+	Namespaces map[string]NamespaceConfig
+
+	// Revocations keeps the revoked tokens. By default, they are kept by the store if it is a
+	// RevocationStore, in memory otherwise.
+	Revocations RevocationList
+}
+
+// RetiredSigningKey is a previous HMAC shared secret. A secret given with an empty ID gets the ID
+// derived from it by SecretKeyID.
+type RetiredSigningKey struct {
+	ID     string
+	Secret []byte
 }
 
 // Service is the service that allow to interact with stored secrets through gRPC.
 type Service struct {
 	infrapb.UnimplementedSecretsServer
 
-	store  SecretStore
-	config Config
+	store          SecretStore
+	config         Config
+	keyring        *Keyring
+	events         *eventBroker
+	revocations    RevocationList
+	revocationFeed *revocationFeed
+	renewBackoff   *renewBackoff
+	defaults       namespaceSettings
+	namespaces     map[string]namespaceSettings
 }
 
 // NewService creates a new service with a given secrets store.
-func NewService(store SecretStore, config Config) *Service {
+func NewService(store SecretStore, config Config) (*Service, error) {
 	if config.TTL == 0 {
 		config.TTL = defaultTTL
 	}
 
 	if config.NearTTL == 0 {
-		config.NearTTL = defaultNearTTL
+		config.NearTTL = defaultRenewBefore(defaultNearTTL, config.TTL)
+	}
+
+	// otherwise, the secrets would be renewed on each tick
+	if config.NearTTL >= config.TTL {
+		return nil, fmt.Errorf("near ttl %s must be shorter than the ttl %s", config.NearTTL, config.TTL)
 	}
 
 	if config.TickDuration == 0 {
 		config.TickDuration = defaultTickerDuration
 	}
 
-	// if the signingKey is empty, it's up to the user. Let's send a warning anyways and carry on...
-	if len(config.SigningKey) == 0 {
-		log.Println("SigningKey is empty, it should have a value, as it's used to encrypt / decrypt the jwt tokens handled by this service.")
+	if config.MaxRenewBefore == 0 {
+		config.MaxRenewBefore = config.NearTTL
+	}
+
+	if config.RenewBatchSize == 0 {
+		config.RenewBatchSize = defaultRenewBatchSize
+	}
+
+	if config.HistorySize == 0 {
+		config.HistorySize = defaultHistorySize
+	}
+
+	if config.Algorithm == "" {
+		config.Algorithm = defaultAlgorithm
+	}
+
+	if config.Keyring == nil {
+		keyring, err := newConfigKeyring(config)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config.Keyring = keyring
+	}
+
+	if config.Revocations == nil {
+		config.Revocations = storeRevocations(store)
+	}
+
+	defaults, err := newNamespaceSettings(config, NamespaceConfig{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := make(map[string]namespaceSettings, len(config.Namespaces))
+
+	for name, namespaceConfig := range config.Namespaces {
+		if err := checkNamespace(name); err != nil {
+			return nil, err
+		}
+
+		settings, err := newNamespaceSettings(config, namespaceConfig)
+
+		if err != nil {
+			return nil, fmt.Errorf("namespace \"%s\" : %w", name, err)
+		}
+
+		namespaces[name] = settings
 	}
 
 	s := &Service{
-		store:  store,
-		config: config,
+		store:          store,
+		config:         config,
+		keyring:        config.Keyring,
+		events:         newEventBroker(defaultEventHistory),
+		revocations:    config.Revocations,
+		revocationFeed: newRevocationFeed(),
+		renewBackoff:   newRenewBackoff(),
+		defaults:       defaults,
+		namespaces:     namespaces,
 	}
 
 	go s.backgroundRenewer()
 
-	return s
+	return s, nil
 }
 
-func (s *Service) List(ctx context.Context, in *infrapb.Empty) (*infrapb.SecretList, error) {
+// newConfigKeyring creates a keyring holding only the key described by the config.
+func newConfigKeyring(config Config) (*Keyring, error) {
+	rawKey := config.PrivateKey
+
+	if _, ok := jwt.GetSigningMethod(config.Algorithm).(*jwt.SigningMethodHMAC); ok {
+		rawKey = config.SigningKey
+
+		// if the signingKey is empty, it's up to the user. Let's send a warning anyways and carry on...
+		if len(config.SigningKey) == 0 {
+			log.Println("SigningKey is empty, it should have a value, as it's used to encrypt / decrypt the jwt tokens handled by this service.")
+		}
+	}
+
+	key, err := NewSigningKey(config.Algorithm, rawKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if config.KeyID != "" {
+		key.ID = config.KeyID
+	}
+
+	retiredAlgorithm := config.Algorithm
+
+	if _, ok := jwt.GetSigningMethod(retiredAlgorithm).(*jwt.SigningMethodHMAC); !ok {
+		retiredAlgorithm = "HS256"
+	}
+
+	retired := make([]SigningKey, 0, len(config.RetiredSigningKeys))
+
+	for _, retiredSecret := range config.RetiredSigningKeys {
+		retiredKey, err := NewSigningKey(retiredAlgorithm, retiredSecret.Secret)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if retiredSecret.ID != "" {
+			retiredKey.ID = retiredSecret.ID
+		}
+
+		retired = append(retired, retiredKey)
+	}
+
+	return NewKeyring(key, retired...)
+}
+
+func (s *Service) List(ctx context.Context, in *infrapb.ListRequest) (*infrapb.SecretList, error) {
+	selector, err := labels.Parse(in.LabelSelector)
+
+	if err != nil {
+		return &infrapb.SecretList{}, status.Errorf(codes.InvalidArgument, "invalid label selector \"%s\" : %s", in.LabelSelector, err)
+	}
+
+	page, err := listPage(in)
+
+	if err != nil {
+		return &infrapb.SecretList{}, status.Errorf(codes.InvalidArgument, "invalid page : %s", err)
+	}
+
+	size := page.Size
+
+	// one more secret is asked to know whether there is a next page
+	page.Size++
+
 	secrets := make([]*infrapb.Secret, 0)
-	storedSecrets, err := s.store.List(ctx)
+	storedSecrets, err := s.store.ListPage(ctx, ListOptions{Namespace: in.Namespace, AllNamespaces: in.AllNamespaces, Selector: selector}, page)
 
 	if err != nil {
 		return &infrapb.SecretList{}, status.Errorf(codes.Internal, "couldn't retrieve list of secrets : %s", err)
 	}
 
+	nextPageToken := ""
+
+	if len(storedSecrets) > size {
+		storedSecrets = storedSecrets[:size]
+		nextPageToken = encodePageToken(in, page, storedSecrets[size-1])
+	}
+
 	for _, v := range storedSecrets {
 		secrets = append(
 			secrets,
-			&infrapb.Secret{
-				Name:   v.Name,
-				Claims: v.Claims,
-			},
+			newSecret(v),
 		)
 	}
 
-	return &infrapb.SecretList{Secrets: secrets}, nil
+	return &infrapb.SecretList{Secrets: secrets, NextPageToken: nextPageToken}, nil
+}
+
+func (s *Service) Get(ctx context.Context, in *infrapb.SecretRef) (*infrapb.SecretDetails, error) {
+	secret, err := s.store.Fetch(ctx, in.Namespace, in.Name)
+
+	if errors.Is(err, ErrSecretNotFound) {
+		return &infrapb.SecretDetails{}, status.Errorf(codes.NotFound, "secret name \"%s\" doesn't exists", in.Name)
+	}
+
+	if err != nil {
+		return &infrapb.SecretDetails{}, status.Errorf(codes.Internal, "couldn't fetch secret : %s", err)
+	}
+
+	return newSecretDetails(secret), nil
 }
 
 func (s *Service) Delete(ctx context.Context, in *infrapb.Secret) (*infrapb.Empty, error) {
-	err := s.store.Delete(ctx, in.Name)
+	secret, fetchErr := s.store.Fetch(ctx, in.Namespace, in.Name)
+	err := s.store.Delete(ctx, in.Namespace, in.Name)
 
 	if err != nil {
 		return &infrapb.Empty{}, status.Errorf(codes.Internal, "couldn't delete secret : %s", err)
 	}
 
+	s.renewBackoff.forget(in.Namespace, in.Name)
+
+	if fetchErr == nil {
+		s.events.publish(SecretDeleted, secret)
+	}
+
 	return &infrapb.Empty{}, nil
 }
 
 func (s *Service) Create(ctx context.Context, in *infrapb.Secret) (*infrapb.Secret, error) {
-	if contains, _ := s.store.Contains(ctx, in.Name); contains {
-		return in, status.Errorf(codes.AlreadyExists, "secret name \"%s\" already exists", in.Name)
+	secret, err := s.createdSecret(ctx, in)
+
+	if err != nil {
+		return in, err
+	}
+
+	if err := createStatus(in.Name, s.store.Create(ctx, secret)); err != nil {
+		return in, err
+	}
+
+	s.events.publish(SecretCreated, secret)
+
+	in.Claims, in.TypedClaims = claimsToProto(secret.Claims)
+
+	return in, nil
+}
+
+// createStatus is the status of the creation of a secret, which fails if it was created
+// concurrently.
+func createStatus(name string, err error) error {
+	if errors.Is(err, ErrSecretExists) {
+		return status.Errorf(codes.AlreadyExists, "secret name \"%s\" already exists", name)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "couldn't create secret : %s", err)
+	}
+
+	return nil
+}
+
+// createdSecret checks a Create request, returning the secret to save. The secret may still be
+// created concurrently, which the store rejects when it's created.
+func (s *Service) createdSecret(ctx context.Context, in *infrapb.Secret) (Secret, error) {
+	if err := checkNamespace(in.Namespace); err != nil {
+		return Secret{}, status.Errorf(codes.InvalidArgument, "invalid namespace : %s", err)
+	}
+
+	if err := checkLabels(in.Labels); err != nil {
+		return Secret{}, status.Errorf(codes.InvalidArgument, "invalid labels : %s", err)
+	}
+
+	if contains, _ := s.store.Contains(ctx, in.Namespace, in.Name); contains {
+		return Secret{}, status.Errorf(codes.AlreadyExists, "secret name \"%s\" already exists", in.Name)
+	}
+
+	secret := Secret{Namespace: in.Namespace, Name: in.Name, Labels: copyLabels(in.Labels)}
+	err := s.parseLifetime(&secret, in.Ttl, in.RenewBefore)
+
+	if err != nil {
+		return Secret{}, status.Errorf(codes.InvalidArgument, "invalid lifetime : %s", err)
 	}
 
-	if in.Claims == nil {
-		in.Claims = make(map[string]string)
+	claims, expirationDate, err := requestClaims(in, s.ttl(secret))
+
+	if err != nil {
+		return Secret{}, status.Errorf(codes.InvalidArgument, "%s", err)
 	}
 
-	if _, ok := in.Claims["exp"]; !ok {
-		in.Claims["exp"] = fmt.Sprint(time.Now().Add(s.config.TTL).Unix())
+	violations := s.checkRequestClaims(in.Namespace, claims, expirationDate)
+	violations = append(violations, s.config.ClaimsSchema.validate(claims)...)
+
+	if len(violations) > 0 {
+		return Secret{}, (&claimsError{violations}).status()
 	}
 
-	unix, err := strconv.Atoi(in.Claims["exp"])
+	token, err := createToken(in.Name, s.tokenClaims(in.Namespace, claims), s.namespace(in.Namespace).keyring.Active())
 
 	if err != nil {
-		return in, status.Errorf(codes.InvalidArgument, "error when parsing time for the expiration date : %s", err)
+		return Secret{}, status.Errorf(codes.Internal, "couldn't encode jwt: %s", err)
+	}
+
+	secret.Claims = claims
+	secret.ExpiresAt = expirationDate
+	secret.RenewedAt = time.Now()
+	secret.Token = token
+
+	recordIssuedToken(&secret)
+	s.recordVersion(&secret, author(ctx))
+
+	return secret, nil
+}
+
+func (s *Service) Update(ctx context.Context, in *infrapb.Secret) (*infrapb.Secret, error) {
+	secret, err := s.store.Fetch(ctx, in.Namespace, in.Name)
+
+	if errors.Is(err, ErrSecretNotFound) {
+		return in, status.Errorf(codes.NotFound, "secret name \"%s\" doesn't exists", in.Name)
 	}
 
-	expirationDate := time.Unix(int64(unix), 0)
+	if err != nil {
+		return in, status.Errorf(codes.Internal, "couldn't fetch secret : %s", err)
+	}
 
-	token, err := createToken(in.Name, in.Claims, s.config.SigningKey)
+	update, err := s.secretUpdate(ctx, in, secret)
 
 	if err != nil {
-		return in, status.Errorf(codes.Internal, "couldn't encode jwt: %s", err)
+		return in, err
 	}
 
-	err = s.store.Save(
-		ctx,
-		Secret{
-			Name:      in.Name,
-			Claims:    in.Claims,
-			ExpiresAt: expirationDate,
-			Token:     token,
-		},
-	)
+	secret, err = s.updateSecret(ctx, secret, update)
 
 	if err != nil {
-		return in, status.Errorf(codes.Internal, "couldn't create secret : %s", err)
+		return in, updateStatus(in.Name, err)
 	}
 
+	s.events.publish(SecretUpdated, secret)
+
+	in.Claims, in.TypedClaims = claimsToProto(secret.Claims)
+	in.Labels = secret.Labels
+
 	return in, nil
 }
 
-func (s *Service) Update(ctx context.Context, in *infrapb.Secret) (*infrapb.Secret, error) {
-	secret, err := s.store.Fetch(ctx, in.Name)
+// secretUpdate checks an Update request against the current secret, returning the change to
+// apply to the secret. The change is applied again if the secret is modified concurrently.
+func (s *Service) secretUpdate(ctx context.Context, in *infrapb.Secret, secret Secret) (func(*Secret) error, error) {
+	// the lifetime is checked against the current one, as only the given fields are updated
+	lifetime := secret
+
+	if err := s.parseLifetime(&lifetime, in.Ttl, in.RenewBefore); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid lifetime : %s", err)
+	}
+
+	if err := checkLabels(in.Labels); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid labels : %s", err)
+	}
+
+	if err := checkRemovedLabels(in.RemoveLabels, in.Labels); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid labels : %s", err)
+	}
+
+	claims, expirationDate, err := requestClaims(in, s.ttl(lifetime))
 
 	if err != nil {
-		return in, status.Errorf(codes.AlreadyExists, "secret name \"%s\" doesn't exists (%s)", in.Name, err)
+		return nil, status.Errorf(codes.InvalidArgument, "%s", err)
 	}
 
-	if in.Claims == nil {
-		in.Claims = make(map[string]string)
+	// the schema is checked once the claims are merged, with the violations of the given claims
+	violations := s.checkRequestClaims(in.Namespace, claims, expirationDate)
+	violations = append(violations, s.checkRemovedClaims(in, claims)...)
+
+	return func(secret *Secret) error {
+		if in.ReplaceClaims {
+			secret.Claims = copyClaims(claims)
+		}
+
+		for k, v := range claims {
+			secret.Claims[k] = v
+		}
+
+		for _, name := range in.RemoveClaims {
+			delete(secret.Claims, name)
+		}
+
+		if secret.Labels == nil && len(in.Labels) > 0 {
+			secret.Labels = make(map[string]string, len(in.Labels))
+		}
+
+		for key, value := range in.Labels {
+			secret.Labels[key] = value
+		}
+
+		for _, key := range in.RemoveLabels {
+			delete(secret.Labels, key)
+		}
+
+		if violations := append(violations, s.config.ClaimsSchema.validate(secret.Claims)...); len(violations) > 0 {
+			return &claimsError{violations}
+		}
+
+		token, err := createToken(secret.Name, s.tokenClaims(secret.Namespace, secret.Claims), s.namespace(secret.Namespace).keyring.Active())
+
+		if err != nil {
+			return fmt.Errorf("couldn't encode jwt : %w", err)
+		}
+
+		if in.Ttl != nil {
+			secret.TTL = lifetime.TTL
+		}
+
+		if in.RenewBefore != nil {
+			secret.RenewBefore = lifetime.RenewBefore
+		}
+
+		secret.ExpiresAt = expirationDate
+		secret.Token = token
+		secret.RenewedAt = time.Now()
+		recordIssuedToken(secret)
+		s.recordVersion(secret, author(ctx))
+
+		return nil
+	}, nil
+}
+
+// updateStatus is the status of an update failing with the given error.
+func updateStatus(name string, err error) error {
+	var claimsErr *claimsError
+
+	if errors.As(err, &claimsErr) {
+		return claimsErr.status()
+	}
+
+	if errors.Is(err, ErrSecretNotFound) {
+		return status.Errorf(codes.NotFound, "secret name \"%s\" was deleted while being updated", name)
 	}
 
-	if _, ok := in.Claims["exp"]; !ok {
-		in.Claims["exp"] = fmt.Sprint(time.Now().Add(s.config.TTL).Unix())
+	if errors.Is(err, ErrSecretConflict) {
+		return status.Errorf(codes.Aborted, "secret name \"%s\" kept being modified while being updated", name)
 	}
 
-	expirationDate, err := strconv.Atoi(in.Claims["exp"])
+	return status.Errorf(codes.Internal, "couldn't update secret : %s", err)
+}
+
+func (s *Service) Renew(ctx context.Context, in *infrapb.RenewRequest) (*infrapb.SecretDetails, error) {
+	ttl, err := s.renewalTTL(in.Ttl)
 
 	if err != nil {
-		return in, status.Errorf(codes.InvalidArgument, "error when parsing time for the expiration date : %s", err)
+		return &infrapb.SecretDetails{}, status.Errorf(codes.InvalidArgument, "invalid ttl : %s", err)
 	}
 
-	for k, v := range in.Claims {
-		secret.Claims[k] = v
+	secret, err := s.store.Fetch(ctx, in.Namespace, in.Name)
+
+	if err == nil {
+		secret, err = s.renewSecret(ctx, s.namespace(secret.Namespace).keyring, secret, ttl, time.Time{})
 	}
 
-	secret.ExpiresAt = time.Unix(int64(expirationDate), 0)
+	if errors.Is(err, ErrSecretNotFound) {
+		return &infrapb.SecretDetails{}, status.Errorf(codes.NotFound, "secret name \"%s\" doesn't exists", in.Name)
+	}
 
-	token, err := createToken(in.Name, in.Claims, s.config.SigningKey)
+	if errors.Is(err, ErrSecretConflict) {
+		return &infrapb.SecretDetails{}, status.Errorf(codes.Aborted, "secret name \"%s\" kept being modified while being renewed", in.Name)
+	}
 
 	if err != nil {
-		return in, status.Errorf(codes.Internal, "couldn't encode jwt: %s", err)
+		return &infrapb.SecretDetails{}, status.Errorf(codes.Internal, "couldn't renew secret : %s", err)
 	}
 
-	secret.Token = token
+	return newSecretDetails(secret), nil
+}
 
-	s.store.Save(ctx, secret)
+func (s *Service) RenewAll(ctx context.Context, in *infrapb.RenewAllRequest) (*infrapb.RenewAllResponse, error) {
+	ttl, err := s.renewalTTL(in.Ttl)
 
-	return in, nil
+	if err != nil {
+		return &infrapb.RenewAllResponse{}, status.Errorf(codes.InvalidArgument, "invalid ttl : %s", err)
+	}
+
+	if _, err := path.Match(in.Selector, ""); err != nil {
+		return &infrapb.RenewAllResponse{}, status.Errorf(codes.InvalidArgument, "invalid selector \"%s\" : %s", in.Selector, err)
+	}
+
+	selector, err := labels.Parse(in.LabelSelector)
+
+	if err != nil {
+		return &infrapb.RenewAllResponse{}, status.Errorf(codes.InvalidArgument, "invalid label selector \"%s\" : %s", in.LabelSelector, err)
+	}
+
+	secrets, err := s.store.List(ctx, ListOptions{Namespace: in.Namespace, AllNamespaces: in.AllNamespaces, Selector: selector})
+
+	if err != nil {
+		return &infrapb.RenewAllResponse{}, status.Errorf(codes.Internal, "couldn't retrieve list of secrets : %s", err)
+	}
+
+	sort.Slice(secrets, func(i, j int) bool {
+		return namespacedKey(secrets[i].Namespace, secrets[i].Name) < namespacedKey(secrets[j].Namespace, secrets[j].Name)
+	})
+
+	results := make([]*infrapb.RenewResult, 0)
+
+	for _, secret := range secrets {
+		if !matchSelector(in.Selector, secret.Name) {
+			continue
+		}
+
+		result := &infrapb.RenewResult{Namespace: secret.Namespace, Name: secret.Name}
+		renewed, err := s.renewSecret(ctx, s.namespace(secret.Namespace).keyring, secret, ttl, time.Time{})
+
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.ExpiresAt = timestamppb.New(renewed.ExpiresAt)
+		}
+
+		results = append(results, result)
+	}
+
+	return &infrapb.RenewAllResponse{Results: results}, nil
 }
 
-func (s *Service) backgroundRenewer() {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*s.config.TickDuration)
-	defer cancel()
+// renewalTTL returns the validity period requested for a renewal, zero meaning the secret's one.
+func (s *Service) renewalTTL(ttl *durationpb.Duration) (time.Duration, error) {
+	lifetime, err := durationFromProto(ttl)
 
+	if err != nil {
+		return 0, err
+	}
+
+	return lifetime, s.checkTTL(lifetime)
+}
+
+// parseLifetime sets the ttl and renew_before given to a secret, checking them against the
+// service's bounds. A nil duration leaves the secret's one untouched, while a zero one resets it
+// to the service's default.
+func (s *Service) parseLifetime(secret *Secret, ttl *durationpb.Duration, renewBefore *durationpb.Duration) error {
+	var err error
+
+	if ttl != nil {
+		if secret.TTL, err = durationFromProto(ttl); err != nil {
+			return fmt.Errorf("invalid ttl : %w", err)
+		}
+	}
+
+	if renewBefore != nil {
+		if secret.RenewBefore, err = durationFromProto(renewBefore); err != nil {
+			return fmt.Errorf("invalid renew_before : %w", err)
+		}
+	}
+
+	if err := s.checkTTL(secret.TTL); err != nil {
+		return err
+	}
+
+	if secret.RenewBefore > s.config.MaxRenewBefore {
+		return fmt.Errorf("renew_before %s is longer than the maximum of %s", secret.RenewBefore, s.config.MaxRenewBefore)
+	}
+
+	// otherwise, the secret would be renewed on each tick. The default one is always shorter.
+	if secret.RenewBefore != 0 && secret.RenewBefore >= s.ttl(*secret) {
+		return fmt.Errorf("renew_before %s must be shorter than the ttl %s", secret.RenewBefore, s.ttl(*secret))
+	}
+
+	return nil
+}
+
+// checkTTL checks a validity period against the service's bounds, zero meaning the default one.
+func (s *Service) checkTTL(ttl time.Duration) error {
+	if ttl != 0 && s.config.MinTTL != 0 && ttl < s.config.MinTTL {
+		return fmt.Errorf("ttl %s is shorter than the minimum of %s", ttl, s.config.MinTTL)
+	}
+
+	if ttl != 0 && s.config.MaxTTL != 0 && ttl > s.config.MaxTTL {
+		return fmt.Errorf("ttl %s is longer than the maximum of %s", ttl, s.config.MaxTTL)
+	}
+
+	return nil
+}
+
+// ttl returns the validity period of the secret's tokens.
+func (s *Service) ttl(secret Secret) time.Duration {
+	if secret.TTL != 0 {
+		return secret.TTL
+	}
+
+	return s.namespace(secret.Namespace).ttl
+}
+
+// renewBefore returns how long before its expiration the secret is renewed.
+func (s *Service) renewBefore(secret Secret) time.Duration {
+	if secret.RenewBefore != 0 {
+		return secret.RenewBefore
+	}
+
+	return defaultRenewBefore(s.config.NearTTL, s.ttl(secret))
+}
+
+// defaultRenewBefore returns how long before their expiration the secrets without their own
+// renew_before are renewed : nearTTL, unless their ttl is not longer, in which case they are
+// renewed halfway through it.
+func defaultRenewBefore(nearTTL time.Duration, ttl time.Duration) time.Duration {
+	if nearTTL >= ttl {
+		return ttl / 2
+	}
+
+	return nearTTL
+}
+
+func durationFromProto(duration *durationpb.Duration) (time.Duration, error) {
+	if duration == nil {
+		return 0, nil
+	}
+
+	if err := duration.CheckValid(); err != nil {
+		return 0, err
+	}
+
+	if duration.AsDuration() < 0 {
+		return 0, fmt.Errorf("%s is negative", duration.AsDuration())
+	}
+
+	return duration.AsDuration(), nil
+}
+
+func durationToProto(duration time.Duration) *durationpb.Duration {
+	if duration == 0 {
+		return nil
+	}
+
+	return durationpb.New(duration)
+}
+
+// matchSelector tells whether a secret name matches a glob pattern. An empty selector matches
+// every name.
+func matchSelector(selector string, name string) bool {
+	if selector == "" {
+		return true
+	}
+
+	matched, _ := path.Match(selector, name)
+
+	return matched
+}
+
+// requestClaims returns the claims of a created or updated secret, and the expiration date of its
+// token : the "exp" claim if given, ttl from now otherwise. The "exp" claim is always a number.
+func requestClaims(in *infrapb.Secret, ttl time.Duration) (map[string]interface{}, time.Time, error) {
+	claims, err := claimsFromProto(in.Claims, in.TypedClaims)
+
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	expirationDate, ok, err := claimTime(claims, "exp")
+
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error when parsing time for the expiration date : %w", err)
+	}
+
+	if !ok {
+		expirationDate = time.Unix(time.Now().Add(ttl).Unix(), 0)
+	}
+
+	claims["exp"] = expirationDate.Unix()
+
+	return claims, expirationDate, nil
+}
+
+// checkRequestClaims returns the violations of the claims given by a client, which can't set the
+// reserved claims of the secret's namespace.
+func (s *Service) checkRequestClaims(namespace string, claims map[string]interface{}, expiresAt time.Time) []claimViolation {
+	var violations []claimViolation
+
+	for _, name := range s.namespace(namespace).reservedClaims {
+		if _, ok := claims[name]; ok {
+			violations = append(violations, claimViolation{name, "is reserved"})
+		}
+	}
+
+	return append(violations, checkRegisteredClaims(claims, expiresAt)...)
+}
+
+// checkRemovedClaims returns the violations of the claims a client asks to remove.
+func (s *Service) checkRemovedClaims(in *infrapb.Secret, claims map[string]interface{}) []claimViolation {
+	var violations []claimViolation
+
+	for _, name := range in.RemoveClaims {
+		switch _, given := claims[name]; {
+		case in.ReplaceClaims:
+			violations = append(violations, claimViolation{name, "can't be removed when the claims are replaced"})
+
+		case name == "exp":
+			violations = append(violations, claimViolation{name, "can't be removed"})
+
+		case given:
+			violations = append(violations, claimViolation{name, "can't be both given and removed"})
+
+		case s.isReservedClaim(in.Namespace, name):
+			violations = append(violations, claimViolation{name, "is reserved"})
+		}
+	}
+
+	return violations
+}
+
+func (s *Service) isReservedClaim(namespace string, name string) bool {
+	for _, reserved := range s.namespace(namespace).reservedClaims {
+		if reserved == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// updateSecret applies the update to the secret and saves it. If the secret was modified in the
+// meantime, it is fetched again and the update is applied to the fetched one, up to
+// maxConflictRetries times.
+func (s *Service) updateSecret(ctx context.Context, secret Secret, update func(*Secret) error) (Secret, error) {
+	for attempt := 0; ; attempt++ {
+		if err := update(&secret); err != nil {
+			return Secret{}, err
+		}
+
+		err := s.store.Save(ctx, secret)
+
+		if err == nil {
+			secret.Revision++
+
+			return secret, nil
+		}
+
+		if !errors.Is(err, ErrSecretConflict) || attempt == maxConflictRetries {
+			return Secret{}, err
+		}
+
+		secret, err = s.store.Fetch(ctx, secret.Namespace, secret.Name)
+
+		if err != nil {
+			return Secret{}, err
+		}
+	}
+}
+
+func (s *Service) backgroundRenewer() {
 	ticker := time.NewTicker(s.config.TickDuration)
 
 	for range ticker.C {
-		s.renewExpiredSecrets(ctx, s.config.SigningKey, s.config.NearTTL, s.config.TTL)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*s.config.TickDuration)
+		s.renewExpiredSecrets(ctx, s.keyring, s.config.NearTTL, s.config.TTL)
+		cancel()
 	}
 }
 
-func (s *Service) renewExpiredSecrets(ctx context.Context, signingKey []byte, nearExpirationDuration time.Duration, ttl time.Duration) {
-	secrets, err := s.store.List(ctx)
+// renewal is a secret due to be renewed by the background renewer, with its keyring and ttl.
+type renewal struct {
+	secret      Secret
+	keyring     *Keyring
+	ttl         time.Duration
+	renewBefore time.Time
+}
 
-	if err != nil {
-		return
+// renewExpiredSecrets renews the secrets expiring before nearExpirationDuration, or before their
+// own renew_before. At most RenewBatchSize secrets are renewed at once, the ones expiring first
+// being renewed first ; the others are renewed on the next ticks. The secrets failing to be
+// renewed are tried again later, so that they don't take the place of the others in the batches.
+func (s *Service) renewExpiredSecrets(ctx context.Context, keyring *Keyring, nearExpirationDuration time.Duration, ttl time.Duration) {
+	now := time.Now()
+	window := nearExpirationDuration
+
+	if s.config.MaxRenewBefore > window {
+		window = s.config.MaxRenewBefore
 	}
 
+	var renewals []renewal
+
+	// the listed secrets which are not due are skipped, more of them being listed until the batch
+	// is full
+	for limit := s.config.RenewBatchSize; ; limit *= 2 {
+		secrets, err := s.store.ListExpiringBefore(ctx, now.Add(window), limit)
+
+		if err != nil {
+			log.Printf("couldn't list the secrets to renew : %s", err)
+			return
+		}
+
+		renewals = s.dueRenewals(secrets, keyring, nearExpirationDuration, ttl, now)
+
+		if limit <= 0 || len(secrets) < limit || len(renewals) >= s.config.RenewBatchSize {
+			break
+		}
+	}
+
+	if s.config.RenewBatchSize > 0 && len(renewals) > s.config.RenewBatchSize {
+		renewals = renewals[:s.config.RenewBatchSize]
+	}
+
+	for _, renewal := range renewals {
+		_, err := s.renewSecret(ctx, renewal.keyring, renewal.secret, renewal.ttl, renewal.renewBefore)
+
+		if err != nil && !errors.Is(err, errSecretRenewed) && !errors.Is(err, ErrSecretNotFound) {
+			log.Printf("couldn't renew secret \"%s\" : %s", renewal.secret.Name, err)
+			s.renewBackoff.failed(renewal.secret, now, s.config.TickDuration)
+
+			continue
+		}
+
+		// a secret deleted in the meantime is forgotten as well
+		s.renewBackoff.forget(renewal.secret.Namespace, renewal.secret.Name)
+	}
+}
+
+// dueRenewals returns the secrets due to be renewed, leaving out the ones which failed to be
+// renewed and are not tried again yet.
+func (s *Service) dueRenewals(secrets []Secret, keyring *Keyring, nearExpirationDuration time.Duration, ttl time.Duration, now time.Time) []renewal {
+	var renewals []renewal
+
 	for _, secret := range secrets {
-		if time.Now().Add(nearExpirationDuration).Before(secret.ExpiresAt) {
+		secretKeyring := keyring
+		secretTTL := ttl
+
+		// the secrets of a configured namespace are renewed with its own key and ttl
+		if settings, ok := s.namespaces[secret.Namespace]; ok {
+			secretKeyring = settings.keyring
+			secretTTL = settings.ttl
+		}
+
+		if secret.TTL != 0 {
+			secretTTL = secret.TTL
+		}
+
+		renewBefore := now.Add(nearExpirationDuration)
+
+		// nearExpirationDuration is given for ttl, and is capped for the secrets with their own ttl
+		if secretTTL != ttl {
+			renewBefore = now.Add(defaultRenewBefore(nearExpirationDuration, secretTTL))
+		}
+
+		if secret.RenewBefore != 0 {
+			renewBefore = now.Add(secret.RenewBefore)
+		}
+
+		if secret.ExpiresAt.After(renewBefore) || s.renewBackoff.delayed(secret, now) {
 			continue
 		}
 
-		token, _ := jwt.Parse(secret.Token, func(token *jwt.Token) (interface{}, error) {
-			return []byte(signingKey), nil
-		})
+		renewals = append(renewals, renewal{secret: secret, keyring: secretKeyring, ttl: secretTTL, renewBefore: renewBefore})
+	}
+
+	return renewals
+}
+
+// renewBackoff delays the next renewal of the secrets which failed to be renewed by the renewer,
+// twice as long after each failure, up to maxRenewBackoff.
+type renewBackoff struct {
+	lock     sync.Mutex
+	failures map[string]renewFailure
+}
+
+type renewFailure struct {
+	attempts int
+	next     time.Time
+}
+
+func newRenewBackoff() *renewBackoff {
+	return &renewBackoff{
+		failures: make(map[string]renewFailure),
+	}
+}
+
+// delayed tells whether the secret failed to be renewed, and must not be tried again yet.
+func (b *renewBackoff) delayed(secret Secret, now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	failure, ok := b.failures[namespacedKey(secret.Namespace, secret.Name)]
+
+	return ok && now.Before(failure.next)
+}
+
+func (b *renewBackoff) failed(secret Secret, now time.Time, tick time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	key := namespacedKey(secret.Namespace, secret.Name)
+	failure := b.failures[key]
+	delay := tick
+
+	for i := 0; i < failure.attempts && delay < maxRenewBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRenewBackoff {
+		delay = maxRenewBackoff
+	}
+
+	failure.attempts++
+	failure.next = now.Add(delay)
+	b.failures[key] = failure
+}
+
+// forget drops the failures of a secret, once it's renewed or deleted.
+func (b *renewBackoff) forget(namespace string, name string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	delete(b.failures, namespacedKey(namespace, name))
+}
+
+// renewSecret re-signs the token of a secret with a new expiration date, ttl (or the secret's
+// validity period if zero) from now. If renewBefore is not zero, the secret is only renewed if it
+// expires before it, errSecretRenewed being returned otherwise.
+func (s *Service) renewSecret(ctx context.Context, keyring *Keyring, secret Secret, ttl time.Duration, renewBefore time.Time) (Secret, error) {
+	renewed, err := s.updateSecret(ctx, secret, func(secret *Secret) error {
+		if !renewBefore.IsZero() && secret.ExpiresAt.After(renewBefore) {
+			return errSecretRenewed
+		}
+
+		token, err := parseToken(secret.Token, keyring.keyfunc)
 
-		newExpiredAt := time.Now().Add(ttl)
+		if err != nil {
+			return fmt.Errorf("couldn't parse the token : %w", err)
+		}
+
+		lifetime := ttl
+
+		if lifetime == 0 {
+			lifetime = s.ttl(*secret)
+		}
+
+		newExpiredAt := time.Now().Add(lifetime)
 
 		claims := token.Claims.(jwt.MapClaims)
 		claims["exp"] = newExpiredAt.Unix()
 
 		secret.ExpiresAt = newExpiredAt
-		secret.Claims["exp"] = fmt.Sprint(newExpiredAt.Unix())
-		secret.Token, _ = token.SignedString(signingKey)
+		secret.RenewedAt = time.Now()
+		secret.Claims["exp"] = newExpiredAt.Unix()
+		secret.Token, err = createToken(secret.Name, s.tokenClaims(secret.Namespace, claims), keyring.Active())
+
+		if err != nil {
+			return err
+		}
 
-		s.store.Save(ctx, secret)
+		recordIssuedToken(secret)
+
+		return nil
+	})
+
+	if err != nil {
+		return Secret{}, err
 	}
+
+	s.events.publish(SecretRenewed, renewed)
+
+	return renewed, nil
+}
+
+func newSecretDetails(secret Secret) *infrapb.SecretDetails {
+	details := &infrapb.SecretDetails{
+		Namespace: secret.Namespace,
+		Name:      secret.Name,
+		Labels:    secret.Labels,
+		Token:     secret.Token,
+		ExpiresAt: timestamppb.New(secret.ExpiresAt),
+	}
+
+	details.Claims, details.TypedClaims = claimsToProto(secret.Claims)
+
+	if !secret.RenewedAt.IsZero() {
+		details.RenewedAt = timestamppb.New(secret.RenewedAt)
+	}
+
+	details.Ttl = durationToProto(secret.TTL)
+	details.RenewBefore = durationToProto(secret.RenewBefore)
+
+	return details
 }
 
-func createToken(name string, claims map[string]string, signingKey []byte) (string, error) {
+func newSecret(secret Secret) *infrapb.Secret {
+	result := &infrapb.Secret{
+		Namespace:   secret.Namespace,
+		Name:        secret.Name,
+		Labels:      secret.Labels,
+		Ttl:         durationToProto(secret.TTL),
+		RenewBefore: durationToProto(secret.RenewBefore),
+	}
+
+	result.Claims, result.TypedClaims = claimsToProto(secret.Claims)
+
+	return result
+}
+
+// tokenClaims returns the claims of a token to issue, with the issuer and the audience of the
+// secret's namespace if they are configured, and the namespace itself unless it's the default one.
+func (s *Service) tokenClaims(namespace string, claims map[string]interface{}) map[string]interface{} {
+	settings := s.namespace(namespace)
+
+	if settings.issuer == "" && len(settings.audience) == 0 && namespace == "" {
+		return claims
+	}
+
+	claims = copyClaims(claims)
+
+	if settings.issuer != "" {
+		claims["iss"] = settings.issuer
+	}
+
+	// a single audience is usually given as a string rather than an array
+	switch len(settings.audience) {
+	case 0:
+	case 1:
+		claims["aud"] = settings.audience[0]
+	default:
+		claims["aud"] = settings.audience
+	}
+
+	if namespace != "" {
+		claims["namespace"] = namespace
+	}
+
+	return claims
+}
+
+func createToken(name string, claims map[string]interface{}, signingKey SigningKey) (string, error) {
 	tokenClaims := jwt.MapClaims{}
-	tokenClaims["id"] = name
 
 	for k, v := range claims {
 		tokenClaims[k] = v
 	}
 
-	// overwrite the exp to be a number rather than a string
-	tokenClaims["exp"], _ = strconv.Atoi(claims["exp"])
+	tokenClaims["id"] = name
+
+	// overwrite the exp to be a number, as it's a string in the claims saved before they were typed
+	if expirationDate, ok, _ := claimTime(claims, "exp"); ok {
+		tokenClaims["exp"] = expirationDate.Unix()
+	}
+
+	// each token is given a unique id, so that it can be revoked, and its date of issue
+	tokenClaims["jti"] = newTokenID()
+	tokenClaims["iat"] = time.Now().Unix()
+
+	return signingKey.sign(tokenClaims)
+}
+
+// parseToken parses and verifies the signature of a token with the key returned by keyfunc. As
+// it's used to renew tokens, its registered claims are not validated : an expired token, or one
+// not valid yet, is renewed all the same.
+func parseToken(tokenString string, keyfunc jwt.Keyfunc) (*jwt.Token, error) {
+	parser := jwt.Parser{SkipClaimsValidation: true}
 
-	return jwt.
-		NewWithClaims(jwt.SigningMethodHS256, tokenClaims).
-		SignedString(signingKey)
+	return parser.Parse(tokenString, keyfunc)
 }
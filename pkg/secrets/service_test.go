@@ -3,6 +3,7 @@ package secrets
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/golang-jwt/jwt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 const testSigningKey = "gisberg"
@@ -29,7 +31,7 @@ func TestList(t *testing.T) {
 	store.Save(ctx, NewSecret("baz", defaultTTL))
 
 	client := infrapb.NewSecretsClient(conn.Dial(ctx))
-	res, err := client.List(ctx, &infrapb.Empty{})
+	res, err := client.List(ctx, &infrapb.ListRequest{})
 
 	if err != nil {
 		t.Fatalf("Unexpected error : %e", err)
@@ -40,6 +42,73 @@ func TestList(t *testing.T) {
 	}
 }
 
+func TestGet(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	t.Run("existing secret", func(t *testing.T) {
+		client := infrapb.NewSecretsClient(conn.Dial(ctx))
+		_, err := client.Create(
+			ctx,
+			&infrapb.Secret{
+				Name: "foo",
+				Claims: map[string]string{
+					"Foo": "bar value",
+				},
+			},
+		)
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		res, err := client.Get(ctx, &infrapb.SecretRef{Name: "foo"})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		secret, _ := store.Fetch(ctx, "", "foo")
+
+		if res.Token == "" || res.Token != secret.Token {
+			t.Fatalf("Expected the stored token, got \"%s\"", res.Token)
+		}
+
+		if res.Claims["Foo"] != "bar value" {
+			t.Fatalf("Expected the stored claims, got %v", res.Claims)
+		}
+
+		if !res.ExpiresAt.AsTime().Equal(secret.ExpiresAt) {
+			t.Fatalf("Expected an expiration date of %s, got %s", secret.ExpiresAt, res.ExpiresAt.AsTime())
+		}
+
+		if res.RenewedAt == nil || !res.RenewedAt.AsTime().Equal(secret.RenewedAt) {
+			t.Fatalf("Expected a renewal date of %s, got %s", secret.RenewedAt, res.RenewedAt.AsTime())
+		}
+	})
+
+	t.Run("not existing secret", func(t *testing.T) {
+		client := infrapb.NewSecretsClient(conn.Dial(ctx))
+		_, err := client.Get(ctx, &infrapb.SecretRef{Name: "bar"})
+
+		if err == nil {
+			t.Fatal("Expected a not found error, got none")
+		}
+
+		statusErr, _ := status.FromError(err)
+
+		if statusErr.Code() != codes.NotFound {
+			t.Fatalf("Expected a status %s, got %s", codes.NotFound, statusErr.Code())
+		}
+	})
+}
+
 func TestDelete(t *testing.T) {
 	store := NewSecretStore()
 	conn := newTestConnection(t, store)
@@ -66,7 +135,7 @@ func TestDelete(t *testing.T) {
 			t.Fatalf("Unexpected error : %e", err)
 		}
 
-		if contains, _ := store.Contains(ctx, "foo"); contains {
+		if contains, _ := store.Contains(ctx, "", "foo"); contains {
 			t.Fatalf("Secret should have been deleted")
 		}
 	})
@@ -109,7 +178,7 @@ func TestCreate(t *testing.T) {
 			t.Fatalf("Unexpected error : %s", err)
 		}
 
-		if contains, _ := store.Contains(ctx, "nominal"); !contains {
+		if contains, _ := store.Contains(ctx, "", "nominal"); !contains {
 			t.Fatalf("Secret not stored")
 		}
 	})
@@ -155,7 +224,7 @@ func TestCreate(t *testing.T) {
 			t.Fatalf("Unexpected error : %s", err)
 		}
 
-		secret, err := store.Fetch(ctx, "valid expiration date")
+		secret, err := store.Fetch(ctx, "", "valid expiration date")
 
 		if err != nil {
 			t.Fatalf("could not fetch Secret")
@@ -188,7 +257,7 @@ func TestCreate(t *testing.T) {
 			t.Fatalf("Expected a status %s, got %s", codes.InvalidArgument, statusErr.Code())
 		}
 
-		if contains, _ := store.Contains(ctx, "with invalid expiration date"); contains {
+		if contains, _ := store.Contains(ctx, "", "with invalid expiration date"); contains {
 			t.Fatalf("Secret was stored anyway, shouldn't be the case")
 		}
 	})
@@ -209,7 +278,7 @@ func TestCreate(t *testing.T) {
 			t.Fatalf("Unexpected error : %s", err)
 		}
 
-		secret, err := store.Fetch(ctx, "jwt")
+		secret, err := store.Fetch(ctx, "", "jwt")
 
 		if err != nil {
 			t.Fatalf("an error occured while saving the secrt : %s", err)
@@ -225,6 +294,28 @@ func TestCreate(t *testing.T) {
 	})
 }
 
+func TestCreateRace(t *testing.T) {
+	racing := NewSecret("racing", defaultTTL)
+	store := racingStore{secretStore: NewSecretStore().(*secretStore), racing: racing}
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+
+	if _, err := client.Create(ctx, &infrapb.Secret{Name: "racing"}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("Expected an AlreadyExists error, got %v", err)
+	}
+
+	if secret, _ := store.Fetch(ctx, "", "racing"); secret.Token != racing.Token {
+		t.Fatal("The concurrently created secret should not be overwritten")
+	}
+}
+
 func TestUpdate(t *testing.T) {
 	store := NewSecretStore()
 	conn := newTestConnection(t, store)
@@ -255,7 +346,7 @@ func TestUpdate(t *testing.T) {
 			t.Fatalf("Unexpected error : %s", err)
 		}
 
-		secret, _ := store.Fetch(ctx, "my secret")
+		secret, _ := store.Fetch(ctx, "", "my secret")
 
 		if secret.ExpiresAt.Sub(time.Unix(now.Unix()+10, 0)) != defaultTTL {
 			t.Fatalf("Invalid expiration date set ; expected %s, got %s", now.Add(defaultTTL), secret.ExpiresAt)
@@ -281,7 +372,7 @@ func TestUpdate(t *testing.T) {
 			t.Fatalf("Unexpected error : %s", err)
 		}
 
-		secret, _ := store.Fetch(ctx, "my secret")
+		secret, _ := store.Fetch(ctx, "", "my secret")
 
 		if secret.ExpiresAt.Sub(time.Unix(now.Unix(), 0)) != defaultTTL {
 			t.Fatalf("Invalid expiration date set ; expected %s difference, got %s", defaultTTL, secret.ExpiresAt.Sub(time.Unix(now.Unix()+10, 0)))
@@ -309,7 +400,7 @@ func TestUpdate(t *testing.T) {
 
 	t.Run("Claims are overwritten and unspecified claims are kept as is", func(t *testing.T) {
 		storedSecret := NewSecret("my secret", defaultTTL)
-		storedSecret.Claims = map[string]string{
+		storedSecret.Claims = map[string]interface{}{
 			"Foo": "should be kept",
 			"Bar": "should be overwritten",
 		}
@@ -332,7 +423,7 @@ func TestUpdate(t *testing.T) {
 			t.Fatalf("Unexpected error : %s", err)
 		}
 
-		secret, _ := store.Fetch(ctx, "my secret")
+		secret, _ := store.Fetch(ctx, "", "my secret")
 
 		expectedClaims := map[string]string{
 			"Foo": "should be kept",
@@ -362,8 +453,8 @@ func TestUpdate(t *testing.T) {
 			},
 		)
 
-		if err == nil {
-			t.Fatal("Should not be able to update a Secret that doesn't exist")
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Expected a NotFound error, got %v", err)
 		}
 	})
 
@@ -388,7 +479,7 @@ func TestUpdate(t *testing.T) {
 			t.Fatalf("Unexpected error : %s", err)
 		}
 
-		secret, err := store.Fetch(ctx, "jwt")
+		secret, err := store.Fetch(ctx, "", "jwt")
 
 		if err != nil {
 			t.Fatalf("an error occured while saving the secrt : %s", err)
@@ -398,6 +489,70 @@ func TestUpdate(t *testing.T) {
 			t.Fatalf("The token should have been regenerated")
 		}
 	})
+
+	t.Run("Claims are removed or replaced", func(t *testing.T) {
+		storedSecret := NewSecret("patched", defaultTTL)
+		storedSecret.Claims = map[string]interface{}{"Foo": "foo", "Bar": "bar", "Baz": "baz"}
+		store.Save(ctx, storedSecret)
+
+		client := infrapb.NewSecretsClient(conn.Dial(ctx))
+		res, err := client.Update(ctx, &infrapb.Secret{Name: "patched", Claims: map[string]string{"Foo": "new foo"}, RemoveClaims: []string{"Bar", "unknown"}})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		secret, _ := store.Fetch(ctx, "", "patched")
+		token, _ := parseToken(secret.Token, conn.service.keyring.keyfunc)
+		tokenClaims := token.Claims.(jwt.MapClaims)
+
+		if _, ok := secret.Claims["Bar"]; ok || secret.Claims["Foo"] != "new foo" || secret.Claims["Baz"] != "baz" {
+			t.Fatalf("Expected the claim to be removed, got %v", secret.Claims)
+		}
+
+		if _, ok := tokenClaims["Bar"]; ok || tokenClaims["Baz"] != "baz" {
+			t.Fatalf("Expected the token to have the resulting claims, got %v", tokenClaims)
+		}
+
+		if res.Claims["Baz"] != "baz" {
+			t.Fatalf("Expected the resulting claims to be returned, got %v", res.Claims)
+		}
+
+		_, err = client.Update(ctx, &infrapb.Secret{Name: "patched", Claims: map[string]string{"Qux": "qux"}, ReplaceClaims: true})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		secret, _ = store.Fetch(ctx, "", "patched")
+
+		if _, ok := secret.Claims["Foo"]; ok || secret.Claims["Qux"] != "qux" || secret.Claims["exp"] == nil {
+			t.Fatalf("Expected the claims to be replaced, got %v", secret.Claims)
+		}
+	})
+
+	t.Run("Invalid removals", func(t *testing.T) {
+		store.Save(ctx, NewSecret("invalid removals", defaultTTL))
+
+		tests := map[string]*infrapb.Secret{
+			"expiration date": {Name: "invalid removals", RemoveClaims: []string{"exp"}},
+			"reserved claim":  {Name: "invalid removals", RemoveClaims: []string{"jti"}},
+			"given claim":     {Name: "invalid removals", Claims: map[string]string{"Foo": "bar"}, RemoveClaims: []string{"Foo"}},
+			"replaced claims": {Name: "invalid removals", ReplaceClaims: true, RemoveClaims: []string{"Foo"}},
+		}
+
+		client := infrapb.NewSecretsClient(conn.Dial(ctx))
+
+		for name, secret := range tests {
+			t.Run(name, func(t *testing.T) {
+				_, err := client.Update(ctx, secret)
+
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expected an invalid argument error, got %v", err)
+				}
+			})
+		}
+	})
 }
 
 func TestRenewExpiredTokens(t *testing.T) {
@@ -410,7 +565,8 @@ func TestRenewExpiredTokens(t *testing.T) {
 	now := time.Now()
 	ctx := context.TODO()
 	store := NewSecretStore()
-	signingKey := []byte(testSigningKey)
+	signingKey, _ := NewSigningKey("HS256", []byte(testSigningKey))
+	keyring, _ := NewKeyring(signingKey)
 
 	tests := map[string]TestCmp{
 		"almost expired": TestCmp{expiresAt: now.Add(10 * time.Minute), shouldBeRenewed: true},
@@ -419,7 +575,7 @@ func TestRenewExpiredTokens(t *testing.T) {
 	}
 
 	for k, v := range tests {
-		claims := map[string]string{
+		claims := map[string]interface{}{
 			"exp": fmt.Sprint(v.expiresAt.Unix()),
 		}
 
@@ -442,10 +598,10 @@ func TestRenewExpiredTokens(t *testing.T) {
 		SigningKey: []byte("colonel gisberg"),
 	}
 
-	service := NewService(store, config)
-	service.renewExpiredSecrets(ctx, signingKey, 20*time.Minute, 5*time.Hour)
+	service, _ := NewService(store, config)
+	service.renewExpiredSecrets(ctx, keyring, 20*time.Minute, 5*time.Hour)
 
-	secrets, _ := store.List(ctx)
+	secrets, _ := store.List(ctx, ListOptions{})
 
 	for _, v := range secrets {
 		test := tests[v.Name]
@@ -462,3 +618,404 @@ func TestRenewExpiredTokens(t *testing.T) {
 		}
 	}
 }
+
+func TestRenewExpiredTokensWithLifetime(t *testing.T) {
+	ctx := context.TODO()
+	store := NewSecretStore()
+	service, _ := NewService(store, Config{SigningKey: []byte(testSigningKey), MaxRenewBefore: 4 * time.Hour})
+
+	tests := map[string]struct {
+		expiresIn       time.Duration
+		renewBefore     time.Duration
+		ttl             time.Duration
+		shouldBeRenewed bool
+	}{
+		"long renew before":  {expiresIn: 2 * time.Hour, renewBefore: 3 * time.Hour, ttl: 8 * time.Hour, shouldBeRenewed: true},
+		"short renew before": {expiresIn: 10 * time.Minute, renewBefore: 5 * time.Minute, shouldBeRenewed: false},
+		"default":            {expiresIn: 10 * time.Minute, shouldBeRenewed: true},
+	}
+
+	for name, test := range tests {
+		claims := map[string]interface{}{"exp": fmt.Sprint(time.Now().Add(test.expiresIn).Unix())}
+		token, _ := createToken(name, claims, service.keyring.Active())
+
+		store.Save(ctx, Secret{
+			Name:        name,
+			Claims:      claims,
+			Token:       token,
+			ExpiresAt:   time.Now().Add(test.expiresIn),
+			TTL:         test.ttl,
+			RenewBefore: test.renewBefore,
+		})
+	}
+
+	service.renewExpiredSecrets(ctx, service.keyring, 20*time.Minute, 5*time.Hour)
+
+	for name, test := range tests {
+		secret, _ := store.Fetch(ctx, "", name)
+		renewed := secret.ExpiresAt.After(time.Now().Add(test.expiresIn + time.Minute))
+
+		if renewed != test.shouldBeRenewed {
+			t.Errorf("%s :: Expected renewed to be %v, expires at %s", name, test.shouldBeRenewed, secret.ExpiresAt)
+		}
+
+		if test.ttl != 0 && time.Until(secret.ExpiresAt) < 7*time.Hour {
+			t.Errorf("%s :: Secret should have been renewed with its own ttl, expires at %s", name, secret.ExpiresAt)
+		}
+	}
+}
+
+func TestRenewExpiredSecretsNotStarved(t *testing.T) {
+	ctx := context.TODO()
+	memory := NewSecretStore()
+	store := failingStore{SecretStore: memory, failing: "failing"}
+	service, _ := NewService(store, Config{SigningKey: []byte(testSigningKey), RenewBatchSize: 1})
+
+	// the first secrets to expire are either not due or failing, and must not hold back "due"
+	expiring := map[string]Secret{
+		"not due":   {ExpiresAt: time.Now().Add(10 * time.Minute), RenewBefore: 5 * time.Minute},
+		"failing-1": {ExpiresAt: time.Now().Add(15 * time.Minute)},
+		"failing-2": {ExpiresAt: time.Now().Add(20 * time.Minute)},
+		"due":       {ExpiresAt: time.Now().Add(30 * time.Minute)},
+	}
+
+	for name, secret := range expiring {
+		claims := map[string]interface{}{"exp": fmt.Sprint(secret.ExpiresAt.Unix())}
+		secret.Name = name
+		secret.Claims = claims
+		secret.Token, _ = createToken(name, claims, service.keyring.Active())
+
+		memory.Save(ctx, secret)
+	}
+
+	for i := 0; i < 3; i++ {
+		service.renewExpiredSecrets(ctx, service.keyring, time.Hour, 5*time.Hour)
+	}
+
+	if secret, _ := memory.Fetch(ctx, "", "due"); time.Until(secret.ExpiresAt) < time.Hour {
+		t.Fatalf("Expected the due secret to be renewed, expires at %s", secret.ExpiresAt)
+	}
+
+	if secret, _ := memory.Fetch(ctx, "", "not due"); time.Until(secret.ExpiresAt) > time.Hour {
+		t.Fatalf("Expected the secret not due not to be renewed, expires at %s", secret.ExpiresAt)
+	}
+
+	if !service.renewBackoff.delayed(Secret{Name: "failing-1"}, time.Now()) {
+		t.Fatal("Expected the renewal of the failing secret to be delayed")
+	}
+
+	// the failures of the deleted secrets are forgotten
+	service.Delete(ctx, &infrapb.Secret{Name: "failing-1"})
+	service.BatchDelete(ctx, &infrapb.BatchDeleteRequest{Secrets: []*infrapb.SecretRef{{Name: "failing-2"}}})
+
+	if len(service.renewBackoff.failures) != 0 {
+		t.Fatalf("Expected the failures of the deleted secrets to be forgotten, got %v", service.renewBackoff.failures)
+	}
+}
+
+func TestLifetime(t *testing.T) {
+	store := NewSecretStore()
+	config := Config{
+		SigningKey:     []byte(testSigningKey),
+		MinTTL:         time.Hour,
+		MaxTTL:         48 * time.Hour,
+		MaxRenewBefore: 2 * time.Hour,
+	}
+	conn := newTestConnectionWithConfig(t, store, config)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+
+	t.Run("create", func(t *testing.T) {
+		_, err := client.Create(ctx, &infrapb.Secret{
+			Name:        "lobby",
+			Ttl:         durationpb.New(48 * time.Hour),
+			RenewBefore: durationpb.New(2 * time.Hour),
+		})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		res, _ := client.Get(ctx, &infrapb.SecretRef{Name: "lobby"})
+
+		if res.Ttl.AsDuration() != 48*time.Hour || res.RenewBefore.AsDuration() != 2*time.Hour {
+			t.Fatalf("Lifetime should have been kept, got %v", res)
+		}
+
+		if expiresIn := time.Until(res.ExpiresAt.AsTime()); expiresIn < 47*time.Hour {
+			t.Fatalf("Token should be valid for the secret's ttl, expires in %s", expiresIn)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		_, err := client.Update(ctx, &infrapb.Secret{Name: "lobby", Ttl: durationpb.New(3 * time.Hour)})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		secret, _ := store.Fetch(ctx, "", "lobby")
+
+		if secret.TTL != 3*time.Hour || secret.RenewBefore != 2*time.Hour || time.Until(secret.ExpiresAt) > 3*time.Hour {
+			t.Fatalf("Only the ttl should have been updated, got %v", secret)
+		}
+
+		// a zero duration resets to the service's default
+		client.Update(ctx, &infrapb.Secret{Name: "lobby", Ttl: durationpb.New(0)})
+
+		if secret, _ := store.Fetch(ctx, "", "lobby"); secret.TTL != 0 {
+			t.Fatalf("Ttl should have been reset, got %s", secret.TTL)
+		}
+	})
+
+	tests := map[string]*infrapb.Secret{
+		"ttl too short":                {Name: "invalid", Ttl: durationpb.New(time.Minute)},
+		"ttl too long":                 {Name: "invalid", Ttl: durationpb.New(72 * time.Hour)},
+		"negative ttl":                 {Name: "invalid", Ttl: durationpb.New(-time.Hour)},
+		"renew before too long":        {Name: "invalid", RenewBefore: durationpb.New(3 * time.Hour)},
+		"renew before longer than ttl": {Name: "invalid", Ttl: durationpb.New(time.Hour), RenewBefore: durationpb.New(time.Hour)},
+	}
+
+	for name, in := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := client.Create(ctx, in)
+
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Expected an InvalidArgument error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestShortTTL(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnectionWithConfig(t, store, Config{
+		SigningKey: []byte(testSigningKey),
+		TTL:        30 * time.Minute,
+		Namespaces: map[string]NamespaceConfig{"game": {TTL: 10 * time.Minute}},
+	})
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+
+	// without renew_before, the secrets are renewed halfway through a ttl shorter than the near ttl
+	for _, in := range []*infrapb.Secret{
+		{Name: "short"},
+		{Namespace: "game", Name: "short"},
+		{Name: "shorter", Ttl: durationpb.New(time.Minute)},
+	} {
+		if _, err := client.Create(ctx, in); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+	}
+
+	if renewBefore := conn.service.renewBefore(Secret{Namespace: "game"}); renewBefore != 5*time.Minute {
+		t.Fatalf("Expected the secrets of the namespace to be renewed 5m before they expire, got %s", renewBefore)
+	}
+
+	if _, err := NewService(store, Config{TTL: time.Hour, NearTTL: time.Hour}); err == nil {
+		t.Fatal("Expected an error for a near ttl as long as the ttl")
+	}
+}
+
+func TestRenew(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+	client.Create(ctx, &infrapb.Secret{Name: "foo", Claims: map[string]string{"Foo": "bar"}})
+	created, _ := store.Fetch(ctx, "", "foo")
+
+	t.Run("default ttl", func(t *testing.T) {
+		res, err := client.Renew(ctx, &infrapb.RenewRequest{Name: "foo"})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if !res.RenewedAt.AsTime().After(created.RenewedAt) || res.Claims["Foo"] != "bar" {
+			t.Fatalf("Token should have been renewed with the same claims, got %v", res)
+		}
+
+		if res.ExpiresAt.AsTime().Before(created.ExpiresAt) {
+			t.Fatalf("Expiration date should have been pushed back, got %s", res.ExpiresAt.AsTime())
+		}
+	})
+
+	t.Run("given ttl", func(t *testing.T) {
+		res, err := client.Renew(ctx, &infrapb.RenewRequest{Name: "foo", Ttl: durationpb.New(time.Hour)})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if expiresIn := time.Until(res.ExpiresAt.AsTime()); expiresIn > time.Hour || expiresIn < 59*time.Minute {
+			t.Fatalf("Token should expire in an hour, expires in %s", expiresIn)
+		}
+	})
+
+	t.Run("invalid ttl", func(t *testing.T) {
+		_, err := client.Renew(ctx, &infrapb.RenewRequest{Name: "foo", Ttl: durationpb.New(-time.Hour)})
+
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected an InvalidArgument error, got %v", err)
+		}
+	})
+
+	t.Run("not existing secret", func(t *testing.T) {
+		_, err := client.Renew(ctx, &infrapb.RenewRequest{Name: "not existing"})
+
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("Expected a NotFound error, got %v", err)
+		}
+	})
+}
+
+func TestRenewAll(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+	client.Create(ctx, &infrapb.Secret{Name: "eu-1"})
+	client.Create(ctx, &infrapb.Secret{Name: "eu-2"})
+	client.Create(ctx, &infrapb.Secret{Name: "us-1"})
+
+	// a secret whose token can't be parsed can't be renewed
+	broken := NewSecret("eu-broken", defaultTTL)
+	broken.Token = "not a jwt"
+	store.Save(ctx, broken)
+
+	res, err := client.RenewAll(ctx, &infrapb.RenewAllRequest{Selector: "eu-*", Ttl: durationpb.New(time.Hour)})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if len(res.Results) != 3 || res.Results[0].Name != "eu-1" || res.Results[1].Name != "eu-2" || res.Results[2].Name != "eu-broken" {
+		t.Fatalf("Expected results for [eu-1 eu-2 eu-broken], got %v", res.Results)
+	}
+
+	if res.Results[0].Error != "" || res.Results[0].ExpiresAt == nil || res.Results[2].Error == "" {
+		t.Fatalf("Only eu-broken should have failed to be renewed, got %v", res.Results)
+	}
+
+	if secret, _ := store.Fetch(ctx, "", "us-1"); time.Until(secret.ExpiresAt) < 2*time.Hour {
+		t.Fatalf("Secrets not matching the selector should not be renewed, us-1 expires at %s", secret.ExpiresAt)
+	}
+
+	_, err = client.RenewAll(ctx, &infrapb.RenewAllRequest{Selector: "["})
+
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected an InvalidArgument error, got %v", err)
+	}
+
+	client.Create(ctx, &infrapb.Secret{Namespace: "game", Name: "eu-1", Labels: map[string]string{"tier": "gold"}})
+	client.Create(ctx, &infrapb.Secret{Namespace: "game", Name: "eu-2"})
+	client.Create(ctx, &infrapb.Secret{Name: "eu-3", Labels: map[string]string{"tier": "gold"}})
+
+	res, err = client.RenewAll(ctx, &infrapb.RenewAllRequest{AllNamespaces: true, LabelSelector: "tier=gold"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if len(res.Results) != 2 || res.Results[0].Name != "eu-3" || res.Results[1].Namespace != "game" || res.Results[1].Name != "eu-1" {
+		t.Fatalf("Expected results for [eu-3 game/eu-1], got %v", res.Results)
+	}
+
+	_, err = client.RenewAll(ctx, &infrapb.RenewAllRequest{LabelSelector: "tier in"})
+
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected an InvalidArgument error, got %v", err)
+	}
+}
+
+func TestUpdateWhileRenewing(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnection(t, store)
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+	_, err := client.Create(ctx, &infrapb.Secret{Name: "foo"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		updating = make(chan struct{})
+	)
+
+	// every secret is always near its expiration, so that the renewer keeps saving it
+	go func() {
+		for {
+			select {
+			case <-updating:
+				return
+			default:
+				conn.service.renewExpiredSecrets(ctx, conn.service.keyring, 2*defaultTTL, defaultTTL)
+			}
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 25; j++ {
+				_, err := client.Update(ctx, &infrapb.Secret{
+					Name:   "foo",
+					Claims: map[string]string{fmt.Sprintf("claim %d-%d", i, j): "value"},
+				})
+
+				if err != nil {
+					t.Errorf("Unexpected error : %s", err)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(updating)
+
+	secret, _ := store.Fetch(ctx, "", "foo")
+
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 25; j++ {
+			if _, ok := secret.Claims[fmt.Sprintf("claim %d-%d", i, j)]; !ok {
+				t.Fatalf("Claim %d-%d was lost by a concurrent save", i, j)
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package secrets
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// SigningKey is the key used to sign the jwt tokens handled by the service, and to verify them
+// when they need to be renewed.
+type SigningKey struct {
+	// ID is sent as the "kid" header of the tokens signed by this key, so that the right key
+	// can be picked to verify them.
+	ID     string
+	Method jwt.SigningMethod
+
+	// Private is used to sign the tokens, Public to verify them. For the HMAC algorithms, both
+	// are the shared secret.
+	Private interface{}
+	Public  interface{}
+}
+
+// NewSigningKey builds a SigningKey for the given algorithm.
+// For the HMAC algorithms (HS256, HS384, HS512), key is the shared secret. For the asymmetric ones
+// (RS256, RS384, RS512, ES256, ES384, EdDSA), key is a PEM encoded private key.
+//
+// The ID of an asymmetric key is derived from its public key, and the one of an HMAC key from the
+// shared secret ; it can be overwritten afterwards.
+func NewSigningKey(algorithm string, key []byte) (SigningKey, error) {
+	signingKey, err := newSigningKey(algorithm, key)
+
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	if _, ok := signingKey.Method.(*jwt.SigningMethodHMAC); ok {
+		signingKey.ID = SecretKeyID(key)
+	} else {
+		signingKey.ID, err = publicKeyID(signingKey.Public)
+	}
+
+	return signingKey, err
+}
+
+// NewSigningKeyFromPEM builds a SigningKey from a PEM encoded private key, guessing the
+// algorithm from the type of the key (RS256 for RSA, ES256 or ES384 for ECDSA depending on the
+// curve, and EdDSA for Ed25519).
+func NewSigningKeyFromPEM(key []byte) (SigningKey, error) {
+	block, _ := pem.Decode(key)
+
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("key is not PEM encoded")
+	}
+
+	var (
+		private interface{}
+		err     error
+	)
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("couldn't parse private key : %w", err)
+	}
+
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		return NewSigningKey("RS256", key)
+	case *ecdsa.PrivateKey:
+		if k.Curve == elliptic.P384() {
+			return NewSigningKey("ES384", key)
+		}
+
+		return NewSigningKey("ES256", key)
+	case ed25519.PrivateKey:
+		return NewSigningKey("EdDSA", key)
+	}
+
+	return SigningKey{}, fmt.Errorf("unsupported private key type %T", private)
+}
+
+func newSigningKey(algorithm string, key []byte) (SigningKey, error) {
+	method := jwt.GetSigningMethod(algorithm)
+
+	if method == nil {
+		return SigningKey{}, fmt.Errorf("unsupported signing algorithm \"%s\"", algorithm)
+	}
+
+	switch m := method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return SigningKey{Method: m, Private: key, Public: key}, nil
+
+	case *jwt.SigningMethodRSA:
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+
+		if err != nil {
+			return SigningKey{}, fmt.Errorf("couldn't parse RSA private key : %w", err)
+		}
+
+		return SigningKey{Method: m, Private: private, Public: &private.PublicKey}, nil
+
+	case *jwt.SigningMethodECDSA:
+		private, err := jwt.ParseECPrivateKeyFromPEM(key)
+
+		if err != nil {
+			return SigningKey{}, fmt.Errorf("couldn't parse ECDSA private key : %w", err)
+		}
+
+		if curve := ecdsaCurve(m); private.Curve != curve {
+			return SigningKey{}, fmt.Errorf("%s expects a %s key, got a %s one", m.Alg(), curve.Params().Name, private.Curve.Params().Name)
+		}
+
+		return SigningKey{Method: m, Private: private, Public: &private.PublicKey}, nil
+
+	case *jwt.SigningMethodEd25519:
+		private, err := jwt.ParseEdPrivateKeyFromPEM(key)
+
+		if err != nil {
+			return SigningKey{}, fmt.Errorf("couldn't parse Ed25519 private key : %w", err)
+		}
+
+		edPrivate := private.(ed25519.PrivateKey)
+
+		return SigningKey{Method: m, Private: edPrivate, Public: edPrivate.Public()}, nil
+	}
+
+	return SigningKey{}, fmt.Errorf("unsupported signing algorithm \"%s\"", algorithm)
+}
+
+// sign signs the given claims with the key, advertising its ID in the "kid" header.
+func (k SigningKey) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.Method, claims)
+
+	if k.ID != "" {
+		token.Header["kid"] = k.ID
+	}
+
+	return token.SignedString(k.Private)
+}
+
+// keyfunc is used to verify tokens signed by this key. It refuses any token which was not signed
+// with the key's algorithm, so that a public key can't be used as an HMAC secret.
+func (k SigningKey) keyfunc(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing algorithm \"%s\"", token.Method.Alg())
+	}
+
+	return k.Public, nil
+}
+
+// publicKeyID derives a key ID from the hash of the DER encoded public key.
+func publicKeyID(public interface{}) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+
+	if err != nil {
+		return "", fmt.Errorf("couldn't encode public key : %w", err)
+	}
+
+	hash := sha256.Sum256(der)
+
+	return base64.RawURLEncoding.EncodeToString(hash[:12]), nil
+}
+
+// SecretKeyID derives the key ID from the hash of an HMAC shared secret. Only part of the hash is
+// used, so that the ID doesn't give away more than the tokens signed with the secret.
+func SecretKeyID(secret []byte) string {
+	hash := sha256.Sum256(secret)
+
+	return base64.RawURLEncoding.EncodeToString(hash[:12])
+}
+
+func ecdsaCurve(method *jwt.SigningMethodECDSA) elliptic.Curve {
+	switch method.CurveBits {
+	case 384:
+		return elliptic.P384()
+	case 521:
+		return elliptic.P521()
+	}
+
+	return elliptic.P256()
+}
@@ -0,0 +1,156 @@
+package secrets
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	"github.com/golang-jwt/jwt"
+)
+
+func generateTestPrivateKey(t *testing.T, algorithm string) []byte {
+	var (
+		key interface{}
+		err error
+	)
+
+	switch algorithm {
+	case "RS256":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "EdDSA":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("no test key for algorithm %s", algorithm)
+	}
+
+	if err != nil {
+		t.Fatalf("couldn't generate %s key : %s", algorithm, err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+
+	if err != nil {
+		t.Fatalf("couldn't marshal %s key : %s", algorithm, err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestNewSigningKey(t *testing.T) {
+	for _, algorithm := range []string{"RS256", "ES256", "ES384", "EdDSA"} {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := NewSigningKey(algorithm, generateTestPrivateKey(t, algorithm))
+
+			if err != nil {
+				t.Fatalf("Unexpected error : %s", err)
+			}
+
+			signed, err := createToken("foo", map[string]interface{}{"exp": "4102444800"}, key)
+
+			if err != nil {
+				t.Fatalf("Unexpected error : %s", err)
+			}
+
+			token, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+				return key.Public, nil
+			})
+
+			if err != nil || !token.Valid {
+				t.Fatalf("Token should be verifiable with the public key (%s)", err)
+			}
+
+			if token.Method.Alg() != algorithm {
+				t.Fatalf("Expected a token signed with %s, got %s", algorithm, token.Method.Alg())
+			}
+		})
+	}
+
+	t.Run("curve mismatch", func(t *testing.T) {
+		if _, err := NewSigningKey("ES256", generateTestPrivateKey(t, "ES384")); err == nil {
+			t.Fatal("Expected an error when using a P-384 key for ES256")
+		}
+	})
+
+	t.Run("key type mismatch", func(t *testing.T) {
+		if _, err := NewSigningKey("RS256", generateTestPrivateKey(t, "EdDSA")); err == nil {
+			t.Fatal("Expected an error when using an Ed25519 key for RS256")
+		}
+	})
+
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		if _, err := NewSigningKey("none", nil); err == nil {
+			t.Fatal("Expected an error for an unsupported algorithm")
+		}
+	})
+
+	t.Run("algorithm confusion", func(t *testing.T) {
+		key, _ := NewSigningKey("ES256", generateTestPrivateKey(t, "ES256"))
+		hmac, _ := NewSigningKey("HS256", []byte(testSigningKey))
+
+		signed, _ := createToken("foo", map[string]interface{}{"exp": "4102444800"}, hmac)
+
+		if _, err := parseToken(signed, key.keyfunc); err == nil {
+			t.Fatal("A HS256 token should not be accepted by an ES256 key")
+		}
+	})
+}
+
+func TestNewSigningKeyFromPEM(t *testing.T) {
+	for _, algorithm := range []string{"RS256", "ES256", "ES384", "EdDSA"} {
+		key, err := NewSigningKeyFromPEM(generateTestPrivateKey(t, algorithm))
+
+		if err != nil {
+			t.Fatalf("%s :: Unexpected error : %s", algorithm, err)
+		}
+
+		if key.Method.Alg() != algorithm {
+			t.Errorf("Expected %s, got %s", algorithm, key.Method.Alg())
+		}
+
+		if key.ID == "" {
+			t.Errorf("%s :: Expected a derived key ID", algorithm)
+		}
+	}
+}
+
+func TestCreateWithAsymmetricKey(t *testing.T) {
+	store := NewSecretStore()
+	conn := newTestConnectionWithConfig(t, store, Config{
+		Algorithm:  "ES256",
+		PrivateKey: generateTestPrivateKey(t, "ES256"),
+	})
+
+	conn.Start()
+	defer conn.Stop()
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	client := infrapb.NewSecretsClient(conn.Dial(ctx))
+	_, err := client.Create(ctx, &infrapb.Secret{Name: "asymmetric"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	secret, _ := store.Fetch(ctx, "", "asymmetric")
+	token, _, err := new(jwt.Parser).ParseUnverified(secret.Token, jwt.MapClaims{})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if token.Method.Alg() != "ES256" {
+		t.Fatalf("Expected a ES256 token, got %s", token.Method.Alg())
+	}
+}
@@ -2,40 +2,205 @@ package secrets
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"sort"
 	"sync"
 	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 const ()
 
+var (
+	// ErrSecretNotFound is returned by the stores when fetching a secret that doesn't exist.
+	ErrSecretNotFound = errors.New("no such secret")
+
+	// ErrSecretConflict is returned by the stores when a conditional save fails, because the secret
+	// was modified or deleted since it was fetched.
+	ErrSecretConflict = errors.New("secret was modified concurrently")
+
+	// ErrSecretExists is returned by the stores when creating a secret which is already stored.
+	ErrSecretExists = errors.New("secret already exists")
+)
+
 type Secret struct {
+	// Namespace scopes the name of the secret, the empty namespace being the default one.
+	Namespace string
 	Name      string
 	Token     string
 	ExpiresAt time.Time
-	Claims    map[string]string
+	RenewedAt time.Time
+	Claims    map[string]interface{}
+
+	// Labels allow to select the secrets, without being part of their tokens.
+	Labels map[string]string
+
+	// Revision is incremented by the store each time the secret is saved. Saving a secret with a
+	// non zero revision only succeeds if it is still the stored one, while saving it with a zero
+	// revision overwrites whatever is stored.
+	Revision uint64
+
+	// History holds the last versions of the secret, the latest one coming last.
+	History []SecretVersion
+
+	// IssuedTokens holds the tokens issued for the secret which are not expired yet, the current
+	// one included, so that they can be revoked even once replaced.
+	IssuedTokens []IssuedToken
+
+	// TTL and RenewBefore override the service's TTL and NearTTL for this secret, if not zero.
+	TTL         time.Duration
+	RenewBefore time.Duration
+}
+
+// SecretVersion is a snapshot of a secret, taken each time its claims are changed by the service.
+type SecretVersion struct {
+	// Version is the revision of the secret once this version was saved.
+	Version   uint64
+	Claims    map[string]interface{}
+	Token     string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+
+	// Author is who made the change : the address of the client.
+	Author string
+}
+
+// IssuedToken identifies a token issued for a secret.
+type IssuedToken struct {
+	// ID is the "jti" claim of the token.
+	ID        string
+	ExpiresAt time.Time
 }
 
 func NewSecret(name string, ttl time.Duration) Secret {
 	return Secret{
 		Name:      name,
 		ExpiresAt: time.Now().Add(ttl),
-		Claims:    map[string]string{},
+		Claims:    map[string]interface{}{},
 		Token:     "",
 	}
 }
 
+// clone returns a copy of the secret that doesn't share its claims, its labels nor its history.
+func (s Secret) clone() Secret {
+	s.Claims = copyClaims(s.Claims)
+	s.Labels = copyLabels(s.Labels)
+	s.History = append([]SecretVersion(nil), s.History...)
+	s.IssuedTokens = append([]IssuedToken(nil), s.IssuedTokens...)
+
+	return s
+}
+
+// ListOptions filters the secrets listed by a store.
+type ListOptions struct {
+	// Namespace is the namespace of the listed secrets, unless AllNamespaces is set.
+	Namespace     string
+	AllNamespaces bool
+
+	// Selector filters the secrets by their labels, if not nil. The stores able to index the
+	// labels use it to narrow down the secrets they go through.
+	Selector labels.Selector
+}
+
+func (o ListOptions) matches(secret Secret) bool {
+	if !o.AllNamespaces && secret.Namespace != o.Namespace {
+		return false
+	}
+
+	return o.Selector == nil || o.Selector.Matches(labels.Set(secret.Labels))
+}
+
+// ListOrder is the order of the secrets listed by pages.
+type ListOrder int
+
+const (
+	// OrderByName orders the secrets by namespace, then by name.
+	OrderByName ListOrder = iota
+
+	// OrderByExpiry orders the secrets by expiration date, then by namespace and name.
+	OrderByExpiry
+)
+
+// PageOptions selects a page of the listed secrets.
+type PageOptions struct {
+	OrderBy ListOrder
+
+	// Size is the maximum number of secrets of the page, every secret being listed if 0.
+	Size int
+
+	// After is the position of the last secret of the previous page, the first page being listed
+	// if nil.
+	After *PageCursor
+}
+
+// PageCursor is the position of a secret in the listed secrets.
+type PageCursor struct {
+	Namespace string
+	Name      string
+	ExpiresAt time.Time
+}
+
+func newPageCursor(secret Secret) PageCursor {
+	return PageCursor{Namespace: secret.Namespace, Name: secret.Name, ExpiresAt: secret.ExpiresAt}
+}
+
+// before tells whether the position comes before the other one in the given order. The names are
+// compared through their namespaced keys, which are ordered by namespace then by name.
+func (c PageCursor) before(other PageCursor, order ListOrder) bool {
+	if order == OrderByExpiry && !c.ExpiresAt.Equal(other.ExpiresAt) {
+		return c.ExpiresAt.Before(other.ExpiresAt)
+	}
+
+	return namespacedKey(c.Namespace, c.Name) < namespacedKey(other.Namespace, other.Name)
+}
+
+// secretStore keeps the secrets in memory. The secrets are cloned when saved and fetched, so that
+// the stored ones can only be modified through Save.
 type secretStore struct {
-	secrets map[string]Secret
+	secrets map[string]Secret // by namespaced key
+	expiry  expiryIndex
 	lock    sync.Mutex
 }
 
 type SecretStore interface {
+	// Save stores the secret, failing with ErrSecretConflict if its revision is not the stored one
+	// (see Secret.Revision).
 	Save(context.Context, Secret) error
-	Delete(context.Context, string) error
-	List(context.Context) ([]Secret, error)
-	Contains(context.Context, string) (bool, error)
-	Fetch(context.Context, string) (Secret, error)
+
+	// Create stores the secret only if there is none with the same namespace and name, failing
+	// with ErrSecretExists otherwise.
+	Create(context.Context, Secret) error
+
+	// Delete, Contains and Fetch find the secret by its namespace and its name.
+	Delete(ctx context.Context, namespace string, name string) error
+	Contains(ctx context.Context, namespace string, name string) (bool, error)
+	Fetch(ctx context.Context, namespace string, name string) (Secret, error)
+
+	List(context.Context, ListOptions) ([]Secret, error)
+
+	// ListPage returns at most page.Size secrets matching the options, in the page.OrderBy order,
+	// starting after page.After. A page shorter than page.Size is the last one.
+	ListPage(context.Context, ListOptions, PageOptions) ([]Secret, error)
+
+	// ListExpiringBefore returns at most limit secrets (all of them if limit is 0) of every
+	// namespace expiring before the given date, the ones expiring first coming first.
+	ListExpiringBefore(context.Context, time.Time, int) ([]Secret, error)
+}
+
+// BatchStore is implemented by the stores able to save or delete several secrets atomically,
+// which the batch RPCs then apply all at once.
+type BatchStore interface {
+	// SaveAll saves every secret as Save does, or none of them if the revision of one of them is
+	// not the stored one.
+	SaveAll(context.Context, []Secret) error
+
+	// CreateAll creates every secret as Create does, or none of them if one of them is already
+	// stored.
+	CreateAll(context.Context, []Secret) error
+
+	// DeleteAll deletes every secret, found by its namespace and its name.
+	DeleteAll(context.Context, []Secret) error
 }
 
 func NewSecretStore() SecretStore {
@@ -45,54 +210,266 @@ func NewSecretStore() SecretStore {
 }
 
 func (s *secretStore) Save(ctx context.Context, in Secret) error {
+	return s.SaveAll(ctx, []Secret{in})
+}
+
+func (s *secretStore) SaveAll(ctx context.Context, secrets []Secret) error {
+	return s.saveAll(secrets, false)
+}
+
+func (s *secretStore) Create(ctx context.Context, in Secret) error {
+	return s.CreateAll(ctx, []Secret{in})
+}
+
+func (s *secretStore) CreateAll(ctx context.Context, secrets []Secret) error {
+	return s.saveAll(secrets, true)
+}
+
+func (s *secretStore) saveAll(secrets []Secret, create bool) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	s.secrets[in.Name] = in
+	// every revision is checked before saving any secret
+	for _, in := range secrets {
+		previous, exists := s.secrets[namespacedKey(in.Namespace, in.Name)]
+
+		if err := checkRevision(previous, exists, in, create); err != nil {
+			return err
+		}
+	}
+
+	for _, in := range secrets {
+		key := namespacedKey(in.Namespace, in.Name)
+		previous, exists := s.secrets[key]
+
+		if exists {
+			s.expiry.remove(previous)
+		}
+
+		in = in.clone()
+		in.Revision = previous.Revision + 1
+		s.secrets[key] = in
+		s.expiry.insert(in)
+	}
 
 	return nil
 }
 
-func (s *secretStore) Delete(ctx context.Context, name string) error {
+func (s *secretStore) Delete(ctx context.Context, namespace string, name string) error {
+	return s.DeleteAll(ctx, []Secret{{Namespace: namespace, Name: name}})
+}
+
+func (s *secretStore) DeleteAll(ctx context.Context, secrets []Secret) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	delete(s.secrets, name)
+	for _, in := range secrets {
+		key := namespacedKey(in.Namespace, in.Name)
+
+		if previous, exists := s.secrets[key]; exists {
+			s.expiry.remove(previous)
+		}
+
+		delete(s.secrets, key)
+	}
 
 	return nil
 }
 
-func (s *secretStore) List(ctx context.Context) ([]Secret, error) {
+func (s *secretStore) ListExpiringBefore(ctx context.Context, before time.Time, limit int) ([]Secret, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result := make([]Secret, 0)
+
+	for _, entry := range s.expiry {
+		if !entry.expiresAt.Before(before) || (limit > 0 && len(result) == limit) {
+			break
+		}
+
+		result = append(result, s.secrets[entry.key].clone())
+	}
+
+	return result, nil
+}
+
+func (s *secretStore) List(ctx context.Context, options ListOptions) ([]Secret, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	var result = make([]Secret, 0, len(s.secrets))
+	var result = make([]Secret, 0)
 
 	for _, v := range s.secrets {
-		result = append(result, v)
+		if options.matches(v) {
+			result = append(result, v.clone())
+		}
 	}
 
 	return result, nil
 }
 
-func (s *secretStore) Contains(ctx context.Context, name string) (bool, error) {
+func (s *secretStore) ListPage(ctx context.Context, options ListOptions, page PageOptions) ([]Secret, error) {
+	secrets, err := s.List(ctx, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pageSecrets(secrets, page), nil
+}
+
+func (s *secretStore) Contains(ctx context.Context, namespace string, name string) (bool, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	_, exists := s.secrets[name]
+	_, exists := s.secrets[namespacedKey(namespace, name)]
 
 	return exists, nil
 }
 
-func (s *secretStore) Fetch(ctx context.Context, name string) (Secret, error) {
+func (s *secretStore) Fetch(ctx context.Context, namespace string, name string) (Secret, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	secret, exists := s.secrets[name]
+	secret, exists := s.secrets[namespacedKey(namespace, name)]
 
 	if !exists {
-		return Secret{}, fmt.Errorf("no such secret")
+		return Secret{}, ErrSecretNotFound
+	}
+
+	return secret.clone(), nil
+}
+
+// checkRevision checks that a secret can be saved over the current one, following the rules of
+// Secret.Revision, or that there is no current one if the secret is created.
+func checkRevision(current Secret, exists bool, in Secret, create bool) error {
+	if create && exists {
+		return ErrSecretExists
+	}
+
+	if in.Revision != 0 && (!exists || current.Revision != in.Revision) {
+		return ErrSecretConflict
+	}
+
+	return nil
+}
+
+// namespacedKey is the key of a secret for the stores keeping every namespace together. The
+// secrets of the default namespace are keyed by their name, so that the ones stored before the
+// namespaces were introduced are still found. The other keys start with a 0xff byte, which never
+// appears in the names as they are valid UTF-8 strings, followed by the namespace and a NUL byte.
+// They are ordered by namespace, then by name.
+func namespacedKey(namespace string, name string) string {
+	if namespace == "" {
+		return name
+	}
+
+	return "\xff" + namespace + "\x00" + name
+}
+
+type expiryEntry struct {
+	expiresAt time.Time
+	key       string
+}
+
+func newExpiryEntry(secret Secret) expiryEntry {
+	return expiryEntry{expiresAt: secret.ExpiresAt, key: namespacedKey(secret.Namespace, secret.Name)}
+}
+
+func (e expiryEntry) less(other expiryEntry) bool {
+	if e.expiresAt.Equal(other.expiresAt) {
+		return e.key < other.key
+	}
+
+	return e.expiresAt.Before(other.expiresAt)
+}
+
+// expiryIndex keeps the secrets ordered by expiration date, so that the ones about to expire can be
+// found without going through every secret.
+type expiryIndex []expiryEntry
+
+func (idx expiryIndex) search(entry expiryEntry) int {
+	return sort.Search(len(idx), func(i int) bool {
+		return !idx[i].less(entry)
+	})
+}
+
+func (idx *expiryIndex) insert(secret Secret) {
+	entry := newExpiryEntry(secret)
+	i := idx.search(entry)
+
+	*idx = append(*idx, expiryEntry{})
+	copy((*idx)[i+1:], (*idx)[i:])
+	(*idx)[i] = entry
+}
+
+func (idx *expiryIndex) remove(secret Secret) {
+	entry := newExpiryEntry(secret)
+	i := idx.search(entry)
+
+	if i < len(*idx) && (*idx)[i].key == entry.key && (*idx)[i].expiresAt.Equal(entry.expiresAt) {
+		*idx = append((*idx)[:i], (*idx)[i+1:]...)
+	}
+}
+
+// filterExpiringBefore implements ListExpiringBefore for the stores that don't have an index on
+// the expiration date.
+func filterExpiringBefore(secrets []Secret, before time.Time, limit int) []Secret {
+	result := make([]Secret, 0)
+
+	for _, secret := range secrets {
+		if secret.ExpiresAt.Before(before) {
+			result = append(result, secret)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return newExpiryEntry(result[i]).less(newExpiryEntry(result[j]))
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result
+}
+
+// pageSecrets implements ListPage for the stores that can't sort the secrets, by sorting every
+// listed secret and cutting the page out of them.
+func pageSecrets(secrets []Secret, page PageOptions) []Secret {
+	sort.Slice(secrets, func(i, j int) bool {
+		return newPageCursor(secrets[i]).before(newPageCursor(secrets[j]), page.OrderBy)
+	})
+
+	if page.After != nil {
+		start := sort.Search(len(secrets), func(i int) bool {
+			return page.After.before(newPageCursor(secrets[i]), page.OrderBy)
+		})
+
+		secrets = secrets[start:]
+	}
+
+	if page.Size > 0 && len(secrets) > page.Size {
+		secrets = secrets[:page.Size]
+	}
+
+	return secrets
+}
+
+// unixNano converts a date to a unix timestamp in nanoseconds, for the stores that can't store
+// dates as is. The zero date is converted to 0.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixNano()
+}
+
+func fromUnixNano(value int64) time.Time {
+	if value == 0 {
+		return time.Time{}
 	}
 
-	return secret, nil
+	return time.Unix(0, value)
 }
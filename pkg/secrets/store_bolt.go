@@ -0,0 +1,493 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltSecretsBucket = []byte("secrets")
+	boltExpiryBucket  = []byte("expiry")
+
+	// boltRevocationsBucket holds the revoked tokens, JSON encoded and keyed by their jti.
+	boltRevocationsBucket = []byte("revocations")
+)
+
+// boltSecretStore stores the secrets in an embedded bbolt database, so that they survive restarts.
+// Each secret is JSON encoded, and keyed by its namespaced key. The expiry bucket indexes the
+// secrets by expiration date, its keys being the date followed by the namespaced key.
+type boltSecretStore struct {
+	db *bolt.DB
+}
+
+// NewBoltSecretStore opens the bbolt database at the given path, creating it if needed. The
+// database is locked as long as the store is not closed.
+func NewBoltSecretStore(path string) (SecretStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open bolt database \"%s\" : %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		secrets, err := tx.CreateBucketIfNotExists(boltSecretsBucket)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(boltRevocationsBucket); err != nil {
+			return err
+		}
+
+		// databases created before the expiry index have to be indexed
+		if tx.Bucket(boltExpiryBucket) != nil {
+			return nil
+		}
+
+		expiry, err := tx.CreateBucket(boltExpiryBucket)
+
+		if err != nil {
+			return err
+		}
+
+		return secrets.ForEach(func(k, v []byte) error {
+			secret, err := decodeBoltSecret(v)
+
+			if err != nil {
+				return err
+			}
+
+			return expiry.Put(boltExpiryKey(secret), k)
+		})
+	})
+
+	if err != nil {
+		db.Close()
+
+		return nil, fmt.Errorf("couldn't initialize bolt database \"%s\" : %w", path, err)
+	}
+
+	return &boltSecretStore{db: db}, nil
+}
+
+// Close releases the database.
+func (s *boltSecretStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *boltSecretStore) Save(ctx context.Context, in Secret) error {
+	return s.SaveAll(ctx, []Secret{in})
+}
+
+// SaveAll saves the secrets in a single transaction, which is rolled back if any of them fails to
+// be saved.
+func (s *boltSecretStore) SaveAll(ctx context.Context, secrets []Secret) error {
+	return s.saveAll(secrets, false)
+}
+
+func (s *boltSecretStore) Create(ctx context.Context, in Secret) error {
+	return s.CreateAll(ctx, []Secret{in})
+}
+
+func (s *boltSecretStore) CreateAll(ctx context.Context, secrets []Secret) error {
+	return s.saveAll(secrets, true)
+}
+
+func (s *boltSecretStore) saveAll(secrets []Secret, create bool) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, in := range secrets {
+			if err := s.save(tx, in, create); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *boltSecretStore) save(tx *bolt.Tx, in Secret, create bool) error {
+	key := []byte(namespacedKey(in.Namespace, in.Name))
+	current, exists, err := s.fetch(tx, key)
+
+	if err != nil {
+		return err
+	}
+
+	if err := checkRevision(current, exists, in, create); err != nil {
+		return err
+	}
+
+	if exists {
+		if err := tx.Bucket(boltExpiryBucket).Delete(boltExpiryKey(current)); err != nil {
+			return err
+		}
+	}
+
+	in.Revision = current.Revision + 1
+	value, err := json.Marshal(in)
+
+	if err != nil {
+		return fmt.Errorf("couldn't encode secret : %w", err)
+	}
+
+	if err := tx.Bucket(boltExpiryBucket).Put(boltExpiryKey(in), key); err != nil {
+		return err
+	}
+
+	return tx.Bucket(boltSecretsBucket).Put(key, value)
+}
+
+func (s *boltSecretStore) Delete(ctx context.Context, namespace string, name string) error {
+	return s.DeleteAll(ctx, []Secret{{Namespace: namespace, Name: name}})
+}
+
+func (s *boltSecretStore) DeleteAll(ctx context.Context, secrets []Secret) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, in := range secrets {
+			if err := s.delete(tx, []byte(namespacedKey(in.Namespace, in.Name))); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *boltSecretStore) delete(tx *bolt.Tx, key []byte) error {
+	current, exists, err := s.fetch(tx, key)
+
+	if err != nil || !exists {
+		return err
+	}
+
+	if err := tx.Bucket(boltExpiryBucket).Delete(boltExpiryKey(current)); err != nil {
+		return err
+	}
+
+	return tx.Bucket(boltSecretsBucket).Delete(key)
+}
+
+// fetch fetches the secret within a transaction, telling whether it exists.
+func (s *boltSecretStore) fetch(tx *bolt.Tx, key []byte) (Secret, bool, error) {
+	value := tx.Bucket(boltSecretsBucket).Get(key)
+
+	if value == nil {
+		return Secret{}, false, nil
+	}
+
+	secret, err := decodeBoltSecret(value)
+
+	return secret, err == nil, err
+}
+
+func (s *boltSecretStore) ListExpiringBefore(ctx context.Context, before time.Time, limit int) ([]Secret, error) {
+	result := make([]Secret, 0)
+	end := boltExpiryKey(Secret{ExpiresAt: before})
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		secrets := tx.Bucket(boltSecretsBucket)
+		cursor := tx.Bucket(boltExpiryBucket).Cursor()
+
+		for k, key := cursor.First(); k != nil && bytes.Compare(k, end) < 0; k, key = cursor.Next() {
+			if limit > 0 && len(result) == limit {
+				break
+			}
+
+			secret, err := decodeBoltSecret(secrets.Get(key))
+
+			if err != nil {
+				return err
+			}
+
+			result = append(result, secret)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *boltSecretStore) List(ctx context.Context, options ListOptions) ([]Secret, error) {
+	return s.ListPage(ctx, options, PageOptions{})
+}
+
+// ListPage goes through the secrets bucket for the secrets ordered by name, and through the expiry
+// index for the ones ordered by expiration date, from the position of the cursor. The labels are
+// not indexed, and are checked on each secret.
+func (s *boltSecretStore) ListPage(ctx context.Context, options ListOptions, page PageOptions) ([]Secret, error) {
+	result := make([]Secret, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		secrets := tx.Bucket(boltSecretsBucket)
+		next := s.pageByName(secrets.Cursor(), options, page.After)
+
+		if page.OrderBy == OrderByExpiry {
+			next = s.pageByExpiry(tx.Bucket(boltExpiryBucket).Cursor(), secrets, page.After)
+		}
+
+		for k, v := next(); k != nil && (page.Size == 0 || len(result) < page.Size); k, v = next() {
+			secret, err := decodeBoltSecret(v)
+
+			if err != nil {
+				return err
+			}
+
+			if options.matches(secret) {
+				result = append(result, secret)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// pageByName returns an iterator over the secrets following the cursor, by namespaced key. Only the
+// keys of the listed namespace are gone through, as they are contiguous (see namespacedKey).
+func (s *boltSecretStore) pageByName(cursor *bolt.Cursor, options ListOptions, after *PageCursor) func() ([]byte, []byte) {
+	prefix := []byte(namespacedKey(options.Namespace, ""))
+	start := prefix
+
+	if options.AllNamespaces {
+		start = nil
+	}
+
+	if after != nil {
+		if key := []byte(namespacedKey(after.Namespace, after.Name)); bytes.Compare(key, start) >= 0 {
+			start = append(key, 0)
+		}
+	}
+
+	started := false
+
+	return func() ([]byte, []byte) {
+		var k, v []byte
+
+		if started {
+			k, v = cursor.Next()
+		} else {
+			k, v = boltSeek(cursor, start)
+			started = true
+		}
+
+		if k != nil && !options.AllNamespaces && (!bytes.HasPrefix(k, prefix) || (options.Namespace == "" && k[0] == 0xff)) {
+			return nil, nil
+		}
+
+		return k, v
+	}
+}
+
+// pageByExpiry returns an iterator over the secrets following the cursor, by expiration date.
+func (s *boltSecretStore) pageByExpiry(cursor *bolt.Cursor, secrets *bolt.Bucket, after *PageCursor) func() ([]byte, []byte) {
+	var start []byte
+
+	if after != nil {
+		start = append(boltExpiryKey(Secret{Namespace: after.Namespace, Name: after.Name, ExpiresAt: after.ExpiresAt}), 0)
+	}
+
+	started := false
+
+	return func() ([]byte, []byte) {
+		var k, key []byte
+
+		if started {
+			k, key = cursor.Next()
+		} else {
+			k, key = boltSeek(cursor, start)
+			started = true
+		}
+
+		if k == nil {
+			return nil, nil
+		}
+
+		return key, secrets.Get(key)
+	}
+}
+
+// boltSeek moves the cursor to the first key following start, or to the first key if start is nil.
+func boltSeek(cursor *bolt.Cursor, start []byte) ([]byte, []byte) {
+	if start == nil {
+		return cursor.First()
+	}
+
+	return cursor.Seek(start)
+}
+
+func (s *boltSecretStore) Contains(ctx context.Context, namespace string, name string) (bool, error) {
+	var exists bool
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(boltSecretsBucket).Get([]byte(namespacedKey(namespace, name))) != nil
+
+		return nil
+	})
+
+	return exists, err
+}
+
+func (s *boltSecretStore) Fetch(ctx context.Context, namespace string, name string) (Secret, error) {
+	var secret Secret
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltSecretsBucket).Get([]byte(namespacedKey(namespace, name)))
+
+		if value == nil {
+			return ErrSecretNotFound
+		}
+
+		var err error
+		secret, err = decodeBoltSecret(value)
+
+		return err
+	})
+
+	return secret, err
+}
+
+// boltExpiryKey is the key of a secret in the expiry index. The sign bit of the date is flipped so
+// that the keys are sorted by date, even before 1970.
+func boltExpiryKey(secret Secret) []byte {
+	name := namespacedKey(secret.Namespace, secret.Name)
+	key := make([]byte, 8, 8+len(name))
+	binary.BigEndian.PutUint64(key, uint64(unixNano(secret.ExpiresAt))^(1<<63))
+
+	return append(key, name...)
+}
+
+func decodeBoltSecret(value []byte) (Secret, error) {
+	var secret Secret
+
+	if err := json.Unmarshal(value, &secret); err != nil {
+		return Secret{}, fmt.Errorf("couldn't decode secret : %w", err)
+	}
+
+	if secret.Claims == nil {
+		secret.Claims = make(map[string]interface{})
+	}
+
+	return secret, nil
+}
+
+// boltRevocationList keeps the revoked tokens in the revocations bucket of the store's database.
+type boltRevocationList struct {
+	db *bolt.DB
+}
+
+func (s *boltSecretStore) Revocations() RevocationList {
+	return &boltRevocationList{db: s.db}
+}
+
+func (l *boltRevocationList) Revoke(ctx context.Context, token RevokedToken) error {
+	value, err := json.Marshal(token)
+
+	if err != nil {
+		return err
+	}
+
+	return l.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltRevocationsBucket)
+		now := time.Now()
+		var expired [][]byte
+
+		// the expired tokens are forgotten on each revocation, once iterated over as bolt can't delete
+		// keys while iterating
+		err := bucket.ForEach(func(k, v []byte) error {
+			revoked, err := decodeBoltRevokedToken(v)
+
+			if err != nil {
+				return err
+			}
+
+			if !revoked.ExpiresAt.After(now) {
+				expired = append(expired, k)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return bucket.Put([]byte(token.ID), value)
+	})
+}
+
+func (l *boltRevocationList) Contains(ctx context.Context, id string) (bool, error) {
+	var contains bool
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltRevocationsBucket).Get([]byte(id))
+
+		if value == nil {
+			return nil
+		}
+
+		token, err := decodeBoltRevokedToken(value)
+		contains = err == nil && token.ExpiresAt.After(time.Now())
+
+		return err
+	})
+
+	return contains, err
+}
+
+func (l *boltRevocationList) List(ctx context.Context) ([]RevokedToken, error) {
+	var result []RevokedToken
+	now := time.Now()
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltRevocationsBucket).ForEach(func(k, v []byte) error {
+			token, err := decodeBoltRevokedToken(v)
+
+			if err == nil && token.ExpiresAt.After(now) {
+				result = append(result, token)
+			}
+
+			return err
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sortRevokedTokens(result)
+
+	return result, nil
+}
+
+func decodeBoltRevokedToken(value []byte) (RevokedToken, error) {
+	var token RevokedToken
+
+	if err := json.Unmarshal(value, &token); err != nil {
+		return RevokedToken{}, fmt.Errorf("couldn't decode revoked token : %w", err)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,58 @@
+package secrets
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestBoltSecretStore(t *testing.T, path string) SecretStore {
+	store, err := NewBoltSecretStore(path)
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	return store
+}
+
+func TestBoltSecretStore(t *testing.T) {
+	store := newTestBoltSecretStore(t, filepath.Join(t.TempDir(), "secrets.db"))
+	defer store.(io.Closer).Close()
+
+	testSecretStore(t, store)
+}
+
+func TestBoltSecretStoreSurvivesRestarts(t *testing.T) {
+	ctx := context.TODO()
+	path := filepath.Join(t.TempDir(), "secrets.db")
+
+	store := newTestBoltSecretStore(t, path)
+	store.Save(ctx, NewSecret("foo", time.Hour))
+	store.(io.Closer).Close()
+
+	store = newTestBoltSecretStore(t, path)
+	defer store.(io.Closer).Close()
+
+	if contains, _ := store.Contains(ctx, "", "foo"); !contains {
+		t.Fatal("Secret should have been kept after reopening the database")
+	}
+}
+
+func TestBoltRevocationList(t *testing.T) {
+	ctx := context.TODO()
+	path := filepath.Join(t.TempDir(), "secrets.db")
+
+	store := newTestBoltSecretStore(t, path)
+	testRevocationList(t, store.(RevocationStore).Revocations())
+	store.(io.Closer).Close()
+
+	store = newTestBoltSecretStore(t, path)
+	defer store.(io.Closer).Close()
+
+	if revoked, _ := store.(RevocationStore).Revocations().Contains(ctx, "first"); !revoked {
+		t.Fatal("Revoked token should have been kept after reopening the database")
+	}
+}
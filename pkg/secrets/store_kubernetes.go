@@ -0,0 +1,589 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	kubernetesClaimsAnnotation    = "secrets.challenge-jwt.taluu.github.io/claims"
+	kubernetesRenewedAtAnnotation = "secrets.challenge-jwt.taluu.github.io/renewed-at"
+	kubernetesRevisionAnnotation  = "secrets.challenge-jwt.taluu.github.io/revision"
+
+	kubernetesTTLAnnotation         = "secrets.challenge-jwt.taluu.github.io/ttl"
+	kubernetesRenewBeforeAnnotation = "secrets.challenge-jwt.taluu.github.io/renew-before"
+
+	// kubernetesLabelsAnnotation lists the labels of the secret, which are also set as the labels of
+	// the Kubernetes Secret so that Kubernetes can select them.
+	kubernetesLabelsAnnotation = "secrets.challenge-jwt.taluu.github.io/labels"
+
+	// kubernetesHistoryDataKey is the data key holding the history, as it contains the previous
+	// tokens.
+	kubernetesHistoryDataKey = "history"
+
+	// kubernetesIssuedTokensAnnotation lists the jti and expiration date of the tokens issued for
+	// the secret.
+	kubernetesIssuedTokensAnnotation = "secrets.challenge-jwt.taluu.github.io/issued-tokens"
+
+	// kubernetesRevocationsConfigMap is the ConfigMap holding the revoked tokens, JSON encoded and
+	// keyed by their jti. It is a ConfigMap, so that its name can't be the one of a secret.
+	kubernetesRevocationsConfigMap = "challenge-jwt-secrets-revocations"
+)
+
+// kubernetesSecretStore stores the secrets as Kubernetes Secrets : the token and the history are in
+// the data, while the claims and the expiration date are in the annotations. Only the Kubernetes Secrets with the
+// managed-by label are considered as being part of the store.
+type kubernetesSecretStore struct {
+	client    kubernetes.Interface
+	namespace string
+
+	// lister lists the Kubernetes Secrets from the informer's cache, if the store has one.
+	lister corev1listers.SecretNamespaceLister
+}
+
+// NewKubernetesSecretStore creates a store using the Kubernetes Secrets of a namespace as storage,
+// so that the service doesn't have to hold any state.
+func NewKubernetesSecretStore(client kubernetes.Interface, namespace string) SecretStore {
+	return &kubernetesSecretStore{
+		client:    client,
+		namespace: namespace,
+	}
+}
+
+// NewCachedKubernetesSecretStore creates a store like NewKubernetesSecretStore, but the secrets are
+// listed from a cache kept up to date by watching the Kubernetes Secrets, instead of being listed
+// from the API on each tick of the renewer. As the cache may lag behind, only the listings use it :
+// the secrets are fetched from the API before being changed. The cache is filled before returning,
+// and is watched until the context is done.
+func NewCachedKubernetesSecretStore(ctx context.Context, client kubernetes.Interface, namespace string) (SecretStore, error) {
+	store := &kubernetesSecretStore{
+		client:    client,
+		namespace: namespace,
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		client,
+		0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = labels.SelectorFromSet(store.labels()).String()
+		}),
+	)
+	informer := factory.Core().V1().Secrets()
+	store.lister = informer.Lister().Secrets(namespace)
+
+	// the informer is registered before the factory is started
+	informer.Informer()
+	factory.Start(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return nil, fmt.Errorf("couldn't fill the cache of the kubernetes secrets of namespace \"%s\"", namespace)
+	}
+
+	return store, nil
+}
+
+func (s *kubernetesSecretStore) Save(ctx context.Context, in Secret) error {
+	return s.save(ctx, in, false)
+}
+
+func (s *kubernetesSecretStore) Create(ctx context.Context, in Secret) error {
+	return s.save(ctx, in, true)
+}
+
+// save relies on the resource version of the Kubernetes Secret, so that the update is rejected by
+// Kubernetes if the secret was modified since its revision was checked. A created secret is
+// rejected by Kubernetes if it was created in the meantime.
+func (s *kubernetesSecretStore) save(ctx context.Context, in Secret, create bool) error {
+	client := s.client.CoreV1().Secrets(s.namespace)
+	name := kubernetesSecretName("", namespacedKey(in.Namespace, in.Name))
+
+	current, err := client.Get(ctx, name, metav1.GetOptions{})
+
+	if apierrors.IsNotFound(err) {
+		if err := checkRevision(Secret{}, false, in, create); err != nil {
+			return err
+		}
+
+		in.Revision = 1
+		secret, err := s.encode(&corev1.Secret{}, in)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = client.Create(ctx, secret, metav1.CreateOptions{})
+
+		if apierrors.IsAlreadyExists(err) && create {
+			return ErrSecretExists
+		}
+
+		if apierrors.IsAlreadyExists(err) {
+			return ErrSecretConflict
+		}
+
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	revision, _ := strconv.ParseUint(current.Annotations[kubernetesRevisionAnnotation], 10, 64)
+
+	if err := checkRevision(Secret{Revision: revision}, true, in, create); err != nil {
+		return err
+	}
+
+	in.Revision = revision + 1
+	secret, err := s.encode(current.DeepCopy(), in)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Update(ctx, secret, metav1.UpdateOptions{})
+
+	if apierrors.IsConflict(err) {
+		return ErrSecretConflict
+	}
+
+	return err
+}
+
+func (s *kubernetesSecretStore) Delete(ctx context.Context, namespace string, name string) error {
+	if contains, err := s.Contains(ctx, namespace, name); err != nil || !contains {
+		return err
+	}
+
+	err := s.client.CoreV1().Secrets(s.namespace).Delete(ctx, kubernetesSecretName("", namespacedKey(namespace, name)), metav1.DeleteOptions{})
+
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *kubernetesSecretStore) List(ctx context.Context, options ListOptions) ([]Secret, error) {
+	selector := labels.SelectorFromSet(s.labels())
+
+	if !options.AllNamespaces {
+		operator, values := selection.Equals, []string{options.Namespace}
+
+		if options.Namespace == "" {
+			operator, values = selection.DoesNotExist, nil
+		}
+
+		requirement, err := labels.NewRequirement(kubernetesNamespaceLabel, operator, values)
+
+		if err != nil {
+			return nil, err
+		}
+
+		selector = selector.Add(*requirement)
+	}
+
+	// the labels of the store can't be the ones of a secret, so requirements on them are left to
+	// the check below
+	for _, requirement := range selectorRequirements(options.Selector) {
+		if !isReservedLabel(requirement.Key()) {
+			selector = selector.Add(requirement)
+		}
+	}
+
+	items, err := s.list(ctx, selector)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Secret, 0, len(items))
+
+	for _, item := range items {
+		secret, err := s.decode(item)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if options.matches(secret) {
+			result = append(result, secret)
+		}
+	}
+
+	return result, nil
+}
+
+// ListPage has to go through every secret, as Kubernetes can only page the Kubernetes Secrets in
+// the order of their names, which are converted.
+func (s *kubernetesSecretStore) ListPage(ctx context.Context, options ListOptions, page PageOptions) ([]Secret, error) {
+	secrets, err := s.List(ctx, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pageSecrets(secrets, page), nil
+}
+
+// ListExpiringBefore has to go through every secret, as Kubernetes can't index the annotations.
+func (s *kubernetesSecretStore) ListExpiringBefore(ctx context.Context, before time.Time, limit int) ([]Secret, error) {
+	secrets, err := s.List(ctx, ListOptions{AllNamespaces: true})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return filterExpiringBefore(secrets, before, limit), nil
+}
+
+func (s *kubernetesSecretStore) Contains(ctx context.Context, namespace string, name string) (bool, error) {
+	_, err := s.Fetch(ctx, namespace, name)
+
+	if err == ErrSecretNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *kubernetesSecretStore) Fetch(ctx context.Context, namespace string, name string) (Secret, error) {
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, kubernetesSecretName("", namespacedKey(namespace, name)), metav1.GetOptions{})
+
+	if apierrors.IsNotFound(err) {
+		return Secret{}, ErrSecretNotFound
+	}
+
+	if err != nil {
+		return Secret{}, err
+	}
+
+	// the Kubernetes Secret may not be handled by the store, or may be the one of another secret
+	// whose name was converted to the same Kubernetes name
+	if !labels.SelectorFromSet(s.labels()).Matches(labels.Set(secret.Labels)) || secret.Annotations[kubernetesNameAnnotation] != name || secret.Labels[kubernetesNamespaceLabel] != namespace {
+		return Secret{}, ErrSecretNotFound
+	}
+
+	return s.decode(secret)
+}
+
+// list lists the Kubernetes Secrets matching the selector, from the cache if the store has one. The
+// listed Kubernetes Secrets must not be modified, as they may be the cached ones.
+func (s *kubernetesSecretStore) list(ctx context.Context, selector labels.Selector) ([]*corev1.Secret, error) {
+	if s.lister != nil {
+		return s.lister.List(selector)
+	}
+
+	list, err := s.client.CoreV1().Secrets(s.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*corev1.Secret, len(list.Items))
+
+	for i := range list.Items {
+		items[i] = &list.Items[i]
+	}
+
+	return items, nil
+}
+
+func (s *kubernetesSecretStore) labels() map[string]string {
+	return map[string]string{kubernetesManagedByLabel: kubernetesManagedBy}
+}
+
+func (s *kubernetesSecretStore) encode(current *corev1.Secret, in Secret) (*corev1.Secret, error) {
+	claims, err := json.Marshal(in.Claims)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode claims : %w", err)
+	}
+
+	history, err := json.Marshal(in.History)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode history : %w", err)
+	}
+
+	secretLabels, err := json.Marshal(in.Labels)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode labels : %w", err)
+	}
+
+	issuedTokens, err := json.Marshal(in.IssuedTokens)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode issued tokens : %w", err)
+	}
+
+	current.Name = kubernetesSecretName("", namespacedKey(in.Namespace, in.Name))
+	current.Namespace = s.namespace
+
+	if current.Type == "" {
+		current.Type = corev1.SecretTypeOpaque
+	}
+
+	if current.Labels == nil {
+		current.Labels = make(map[string]string)
+	}
+
+	// the labels the secret had are removed, as they may not be part of its labels anymore
+	var previous map[string]string
+	json.Unmarshal([]byte(current.Annotations[kubernetesLabelsAnnotation]), &previous)
+
+	for key := range previous {
+		delete(current.Labels, key)
+	}
+
+	for key, value := range in.Labels {
+		current.Labels[key] = value
+	}
+
+	for key, value := range s.labels() {
+		current.Labels[key] = value
+	}
+
+	setNamespaceLabel(current.Labels, in.Namespace)
+
+	if current.Annotations == nil {
+		current.Annotations = make(map[string]string)
+	}
+
+	current.Annotations[kubernetesNameAnnotation] = in.Name
+	current.Annotations[kubernetesClaimsAnnotation] = string(claims)
+	current.Annotations[kubernetesExpiresAtAnnotation] = in.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	current.Annotations[kubernetesRenewedAtAnnotation] = in.RenewedAt.UTC().Format(time.RFC3339Nano)
+	current.Annotations[kubernetesRevisionAnnotation] = strconv.FormatUint(in.Revision, 10)
+	current.Annotations[kubernetesLabelsAnnotation] = string(secretLabels)
+	current.Annotations[kubernetesIssuedTokensAnnotation] = string(issuedTokens)
+
+	setDurationAnnotation(current.Annotations, kubernetesTTLAnnotation, in.TTL)
+	setDurationAnnotation(current.Annotations, kubernetesRenewBeforeAnnotation, in.RenewBefore)
+
+	if current.Data == nil {
+		current.Data = make(map[string][]byte)
+	}
+
+	current.Data[defaultKubernetesDataKey] = []byte(in.Token)
+	current.Data[kubernetesHistoryDataKey] = history
+
+	return current, nil
+}
+
+func (s *kubernetesSecretStore) decode(secret *corev1.Secret) (Secret, error) {
+	result := Secret{
+		Namespace: secret.Labels[kubernetesNamespaceLabel],
+		Name:      secret.Annotations[kubernetesNameAnnotation],
+		Token:     string(secret.Data[defaultKubernetesDataKey]),
+		Claims:    make(map[string]interface{}),
+	}
+
+	if claims, ok := secret.Annotations[kubernetesClaimsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(claims), &result.Claims); err != nil {
+			return Secret{}, fmt.Errorf("couldn't decode claims of kubernetes secret \"%s\" : %w", secret.Name, err)
+		}
+	}
+
+	if result.Claims == nil {
+		result.Claims = make(map[string]interface{})
+	}
+
+	if secretLabels, ok := secret.Annotations[kubernetesLabelsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(secretLabels), &result.Labels); err != nil {
+			return Secret{}, fmt.Errorf("couldn't decode labels of kubernetes secret \"%s\" : %w", secret.Name, err)
+		}
+	}
+
+	if history, ok := secret.Data[kubernetesHistoryDataKey]; ok {
+		if err := json.Unmarshal(history, &result.History); err != nil {
+			return Secret{}, fmt.Errorf("couldn't decode history of kubernetes secret \"%s\" : %w", secret.Name, err)
+		}
+	}
+
+	if issuedTokens, ok := secret.Annotations[kubernetesIssuedTokensAnnotation]; ok {
+		if err := json.Unmarshal([]byte(issuedTokens), &result.IssuedTokens); err != nil {
+			return Secret{}, fmt.Errorf("couldn't decode issued tokens of kubernetes secret \"%s\" : %w", secret.Name, err)
+		}
+	}
+
+	var err error
+
+	result.ExpiresAt, err = time.Parse(time.RFC3339Nano, secret.Annotations[kubernetesExpiresAtAnnotation])
+
+	if err != nil {
+		return Secret{}, fmt.Errorf("couldn't decode expiration date of kubernetes secret \"%s\" : %w", secret.Name, err)
+	}
+
+	if renewedAt, ok := secret.Annotations[kubernetesRenewedAtAnnotation]; ok {
+		result.RenewedAt, _ = time.Parse(time.RFC3339Nano, renewedAt)
+	}
+
+	result.Revision, _ = strconv.ParseUint(secret.Annotations[kubernetesRevisionAnnotation], 10, 64)
+
+	if ttl, ok := secret.Annotations[kubernetesTTLAnnotation]; ok {
+		result.TTL, _ = time.ParseDuration(ttl)
+	}
+
+	if renewBefore, ok := secret.Annotations[kubernetesRenewBeforeAnnotation]; ok {
+		result.RenewBefore, _ = time.ParseDuration(renewBefore)
+	}
+
+	return result, nil
+}
+
+// setDurationAnnotation sets the annotation to the duration, removing it if the duration is zero.
+func setDurationAnnotation(annotations map[string]string, key string, duration time.Duration) {
+	if duration == 0 {
+		delete(annotations, key)
+		return
+	}
+
+	annotations[key] = duration.String()
+}
+
+// kubernetesRevocationList keeps the revoked tokens in a ConfigMap of the store's namespace.
+type kubernetesRevocationList struct {
+	client    kubernetes.Interface
+	namespace string
+}
+
+func (s *kubernetesSecretStore) Revocations() RevocationList {
+	return &kubernetesRevocationList{client: s.client, namespace: s.namespace}
+}
+
+// Revoke relies on the resource version of the ConfigMap, the revocation being tried again if it
+// was modified in the meantime.
+func (l *kubernetesRevocationList) Revoke(ctx context.Context, token RevokedToken) error {
+	client := l.client.CoreV1().ConfigMaps(l.namespace)
+	value, err := json.Marshal(token)
+
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		current, err := client.Get(ctx, kubernetesRevocationsConfigMap, metav1.GetOptions{})
+
+		if apierrors.IsNotFound(err) {
+			_, err = client.Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   kubernetesRevocationsConfigMap,
+					Labels: map[string]string{kubernetesManagedByLabel: kubernetesManagedBy},
+				},
+				Data: map[string]string{token.ID: string(value)},
+			}, metav1.CreateOptions{})
+		} else if err == nil {
+			configMap := current.DeepCopy()
+
+			if configMap.Data == nil {
+				configMap.Data = make(map[string]string)
+			}
+
+			// the expired tokens are forgotten on each revocation
+			for id, encoded := range configMap.Data {
+				if revoked, err := decodeKubernetesRevokedToken(encoded); err == nil && !revoked.ExpiresAt.After(time.Now()) {
+					delete(configMap.Data, id)
+				}
+			}
+
+			configMap.Data[token.ID] = string(value)
+			_, err = client.Update(ctx, configMap, metav1.UpdateOptions{})
+		}
+
+		if (!apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err)) || attempt == maxConflictRetries {
+			return err
+		}
+	}
+}
+
+func (l *kubernetesRevocationList) Contains(ctx context.Context, id string) (bool, error) {
+	tokens, err := l.tokens(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	encoded, ok := tokens[id]
+
+	if !ok {
+		return false, nil
+	}
+
+	token, err := decodeKubernetesRevokedToken(encoded)
+
+	if err != nil {
+		return false, err
+	}
+
+	return token.ExpiresAt.After(time.Now()), nil
+}
+
+func (l *kubernetesRevocationList) List(ctx context.Context) ([]RevokedToken, error) {
+	tokens, err := l.tokens(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]RevokedToken, 0, len(tokens))
+	now := time.Now()
+
+	for _, encoded := range tokens {
+		token, err := decodeKubernetesRevokedToken(encoded)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if token.ExpiresAt.After(now) {
+			result = append(result, token)
+		}
+	}
+
+	sortRevokedTokens(result)
+
+	return result, nil
+}
+
+// tokens returns the data of the revocations ConfigMap, which is empty if it doesn't exist yet.
+func (l *kubernetesRevocationList) tokens(ctx context.Context) (map[string]string, error) {
+	configMap, err := l.client.CoreV1().ConfigMaps(l.namespace).Get(ctx, kubernetesRevocationsConfigMap, metav1.GetOptions{})
+
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return configMap.Data, nil
+}
+
+func decodeKubernetesRevokedToken(encoded string) (RevokedToken, error) {
+	var token RevokedToken
+
+	if err := json.Unmarshal([]byte(encoded), &token); err != nil {
+		return RevokedToken{}, fmt.Errorf("couldn't decode revoked token : %w", err)
+	}
+
+	return token, nil
+}
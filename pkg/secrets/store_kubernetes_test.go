@@ -0,0 +1,132 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestKubernetesSecretStore(t *testing.T) {
+	testSecretStore(t, NewKubernetesSecretStore(fake.NewSimpleClientset(), testKubernetesNamespace))
+}
+
+func TestKubernetesRevocationList(t *testing.T) {
+	testRevocationList(t, NewKubernetesSecretStore(fake.NewSimpleClientset(), testKubernetesNamespace).(RevocationStore).Revocations())
+}
+
+func TestCachedKubernetesSecretStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := fake.NewSimpleClientset()
+	NewKubernetesSecretStore(client, testKubernetesNamespace).Save(ctx, NewSecret("existing", time.Hour))
+
+	store, err := NewCachedKubernetesSecretStore(ctx, client, testKubernetesNamespace)
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	// the secrets stored before are in the cache once created
+	if secrets, _ := store.ListExpiringBefore(ctx, time.Now().Add(2*time.Hour), 0); len(secrets) != 1 || secrets[0].Name != "existing" {
+		t.Fatalf("Expected the existing secret to be listed, got %v", secrets)
+	}
+
+	store.Save(ctx, NewSecret("saved", time.Hour))
+
+	for i := 0; ; i++ {
+		if secrets, _ := store.List(ctx, ListOptions{}); len(secrets) == 2 {
+			break
+		}
+
+		if i == 100 {
+			t.Fatal("Expected the saved secret to be listed from the cache")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	listed := func() int {
+		count := 0
+
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "list" && action.GetResource().Resource == "secrets" {
+				count++
+			}
+		}
+
+		return count
+	}
+
+	before := listed()
+
+	for i := 0; i < 10; i++ {
+		store.ListExpiringBefore(ctx, time.Now().Add(2*time.Hour), 0)
+	}
+
+	if after := listed(); after != before {
+		t.Fatalf("Expected the secrets to be listed from the cache, got %d listings from the API", after-before)
+	}
+}
+
+func TestKubernetesSecretStoreOnlySeesManagedSecrets(t *testing.T) {
+	ctx := context.TODO()
+	client := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "unmanaged",
+				Namespace:   testKubernetesNamespace,
+				Annotations: map[string]string{kubernetesNameAnnotation: "unmanaged"},
+			},
+		},
+	)
+	store := NewKubernetesSecretStore(client, testKubernetesNamespace)
+
+	if contains, _ := store.Contains(ctx, "", "unmanaged"); contains {
+		t.Fatal("Store should not see an unmanaged kubernetes secret")
+	}
+
+	store.Delete(ctx, "", "unmanaged")
+
+	if _, err := client.CoreV1().Secrets(testKubernetesNamespace).Get(ctx, "unmanaged", metav1.GetOptions{}); err != nil {
+		t.Fatal("Store should not delete an unmanaged kubernetes secret")
+	}
+
+	if secrets, _ := store.List(ctx, ListOptions{}); len(secrets) != 0 {
+		t.Fatalf("Store should not list unmanaged kubernetes secrets, got %v", secrets)
+	}
+}
+
+func TestKubernetesSecretStoreLayout(t *testing.T) {
+	ctx := context.TODO()
+	client := fake.NewSimpleClientset()
+	store := NewKubernetesSecretStore(client, testKubernetesNamespace)
+
+	secret := NewSecret("foo", time.Hour)
+	secret.Token = "token"
+	secret.Claims["Foo"] = "bar"
+
+	store.Save(ctx, secret)
+
+	stored, err := client.CoreV1().Secrets(testKubernetesNamespace).Get(ctx, "foo", metav1.GetOptions{})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if string(stored.Data[defaultKubernetesDataKey]) != "token" {
+		t.Fatalf("Expected the token in the data, got %v", stored.Data)
+	}
+
+	if stored.Annotations[kubernetesClaimsAnnotation] != `{"Foo":"bar"}` {
+		t.Fatalf("Expected the claims in the annotations, got %v", stored.Annotations)
+	}
+
+	if stored.Annotations[kubernetesExpiresAtAnnotation] == "" {
+		t.Fatalf("Expected the expiration date in the annotations, got %v", stored.Annotations)
+	}
+}
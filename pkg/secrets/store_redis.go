@@ -0,0 +1,819 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+const defaultRedisPrefix = "secrets"
+
+// redisSecretStore stores each secret as a hash, and indexes the secrets in sorted sets whose members
+// all have the same score, so that they are sorted lexicographically : the names index holds their
+// namespaced keys, the expiry index their expiration date followed by their namespaced key, and the
+// namespace expiry index their namespace followed by their expiration date and their name. A page
+// of secrets is thus listed with a range query from the cursor, and so are the secrets about to
+// expire. The labels are indexed by a set of namespaced keys for each label and value, and for each
+// label, so that the secrets matching a label selector are found without fetching every secret.
+//
+// Every key is in the hash tag of the prefix, so that they are all in the same slot of a Redis
+// Cluster and the transactions updating several of them don't fail with CROSSSLOT.
+type redisSecretStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisSecretStore creates a store using the given redis client. Every key used by the store
+// starts with the prefix ("secrets" by default) as a hash tag, e.g. "{secrets}:expiry".
+func NewRedisSecretStore(client redis.UniversalClient, prefix string) SecretStore {
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+
+	return &redisSecretStore{
+		client: client,
+		prefix: "{" + prefix + "}",
+	}
+}
+
+// secretKey is the key of the hash of a secret, given its namespaced key.
+func (s *redisSecretStore) secretKey(key string) string {
+	return s.prefix + ":secret:" + key
+}
+
+func (s *redisSecretStore) namesKey() string {
+	return s.prefix + ":names"
+}
+
+func (s *redisSecretStore) expiryKey() string {
+	return s.prefix + ":expiry"
+}
+
+func (s *redisSecretStore) namespaceExpiryKey() string {
+	return s.prefix + ":namespace-expiry"
+}
+
+// labelKey is the key of the set of the secrets having the label.
+func (s *redisSecretStore) labelKey(label string) string {
+	return s.prefix + ":label:" + label
+}
+
+// labelValueKey is the key of the set of the secrets having the label with the given value. The "="
+// can't be part of a label, so that it can't be mixed up with a labelKey.
+func (s *redisSecretStore) labelValueKey(label string, value string) string {
+	return s.prefix + ":label:" + label + "=" + value
+}
+
+func (s *redisSecretStore) Save(ctx context.Context, in Secret) error {
+	return s.SaveAll(ctx, []Secret{in})
+}
+
+func (s *redisSecretStore) SaveAll(ctx context.Context, secrets []Secret) error {
+	return s.saveAll(ctx, secrets, false)
+}
+
+func (s *redisSecretStore) Create(ctx context.Context, in Secret) error {
+	return s.CreateAll(ctx, []Secret{in})
+}
+
+func (s *redisSecretStore) CreateAll(ctx context.Context, secrets []Secret) error {
+	return s.saveAll(ctx, secrets, true)
+}
+
+// saveAll watches the secrets while checking their revisions, so that the transaction is aborted
+// if any of them is modified in the meantime.
+func (s *redisSecretStore) saveAll(ctx context.Context, secrets []Secret, create bool) error {
+	members := make([]string, len(secrets))
+	keys := make([]string, len(secrets))
+	values := make([][]interface{}, len(secrets))
+
+	for i, in := range secrets {
+		encoded, err := redisSecretValues(in)
+
+		if err != nil {
+			return err
+		}
+
+		members[i] = namespacedKey(in.Namespace, in.Name)
+		keys[i] = s.secretKey(members[i])
+		values[i] = encoded
+	}
+
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		current := make([]Secret, len(secrets))
+		exists := make([]bool, len(secrets))
+
+		for i, in := range secrets {
+			values, err := tx.HGetAll(ctx, keys[i]).Result()
+
+			if err != nil {
+				return err
+			}
+
+			if len(values) > 0 {
+				current[i].Revision, _ = strconv.ParseUint(values["revision"], 10, 64)
+				json.Unmarshal([]byte(values["labels"]), &current[i].Labels)
+
+				expiresAt, _ := strconv.ParseInt(values["expires_at"], 10, 64)
+				current[i].ExpiresAt = fromUnixNano(expiresAt)
+				exists[i] = true
+			}
+
+			if err := checkRevision(current[i], exists[i], in, create); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, in := range secrets {
+				pipe.Del(ctx, keys[i])
+				pipe.HSet(ctx, keys[i], append(values[i], "revision", current[i].Revision+1)...)
+
+				if exists[i] {
+					s.unindex(ctx, pipe, in.Namespace, in.Name, current[i].ExpiresAt)
+				}
+
+				s.index(ctx, pipe, in.Namespace, in.Name, in.ExpiresAt)
+				s.indexLabels(ctx, pipe, members[i], current[i].Labels, in.Labels)
+			}
+
+			return nil
+		})
+
+		return err
+	}, keys...)
+
+	if errors.Is(err, redis.TxFailedErr) {
+		return ErrSecretConflict
+	}
+
+	return err
+}
+
+// redisSecretValues encodes the fields of the secret's hash, but its revision.
+func redisSecretValues(in Secret) ([]interface{}, error) {
+	claims, err := json.Marshal(in.Claims)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode claims : %w", err)
+	}
+
+	history, err := json.Marshal(in.History)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode history : %w", err)
+	}
+
+	secretLabels, err := json.Marshal(in.Labels)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode labels : %w", err)
+	}
+
+	issuedTokens, err := json.Marshal(in.IssuedTokens)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode issued tokens : %w", err)
+	}
+
+	return []interface{}{
+		"namespace", in.Namespace,
+		"name", in.Name,
+		"token", in.Token,
+		"claims", string(claims),
+		"expires_at", unixNano(in.ExpiresAt),
+		"renewed_at", unixNano(in.RenewedAt),
+		"history", string(history),
+		"ttl", int64(in.TTL),
+		"renew_before", int64(in.RenewBefore),
+		"labels", string(secretLabels),
+		"issued_tokens", string(issuedTokens),
+	}, nil
+}
+
+func (s *redisSecretStore) Delete(ctx context.Context, namespace string, name string) error {
+	return s.DeleteAll(ctx, []Secret{{Namespace: namespace, Name: name}})
+}
+
+// DeleteAll removes the secrets from the indexes and the label sets they were in when they were
+// fetched. The indexes may then keep a secret saved concurrently with another expiration date or
+// other labels, which is harmless as the listed secrets are checked once they are fetched.
+func (s *redisSecretStore) DeleteAll(ctx context.Context, secrets []Secret) error {
+	members := make([]string, len(secrets))
+	fields := make([][]interface{}, len(secrets))
+
+	for i, in := range secrets {
+		var err error
+
+		members[i] = namespacedKey(in.Namespace, in.Name)
+		fields[i], err = s.client.HMGet(ctx, s.secretKey(members[i]), "labels", "expires_at").Result()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, in := range secrets {
+			var secretLabels map[string]string
+
+			encodedLabels, _ := fields[i][0].(string)
+			json.Unmarshal([]byte(encodedLabels), &secretLabels)
+
+			if encodedExpiry, ok := fields[i][1].(string); ok {
+				expiresAt, _ := strconv.ParseInt(encodedExpiry, 10, 64)
+				s.unindex(ctx, pipe, in.Namespace, in.Name, fromUnixNano(expiresAt))
+			}
+
+			pipe.Del(ctx, s.secretKey(members[i]))
+			s.indexLabels(ctx, pipe, members[i], secretLabels, nil)
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+// indexMembers returns the members of the secret in the names, expiry and namespace expiry indexes,
+// by index key.
+func (s *redisSecretStore) indexMembers(namespace string, name string, expiresAt time.Time) map[string]string {
+	return map[string]string{
+		s.namesKey():           namespacedKey(namespace, name),
+		s.expiryKey():          redisSortKey(expiresAt) + namespacedKey(namespace, name),
+		s.namespaceExpiryKey(): namespacedKey(namespace, redisSortKey(expiresAt)+name),
+	}
+}
+
+func (s *redisSecretStore) index(ctx context.Context, pipe redis.Pipeliner, namespace string, name string, expiresAt time.Time) {
+	for key, member := range s.indexMembers(namespace, name, expiresAt) {
+		pipe.ZAdd(ctx, key, &redis.Z{Member: member})
+	}
+}
+
+func (s *redisSecretStore) unindex(ctx context.Context, pipe redis.Pipeliner, namespace string, name string, expiresAt time.Time) {
+	for key, member := range s.indexMembers(namespace, name, expiresAt) {
+		pipe.ZRem(ctx, key, member)
+	}
+}
+
+// indexLabels moves the secret from the sets of its previous labels to the ones of its current
+// labels.
+func (s *redisSecretStore) indexLabels(ctx context.Context, pipe redis.Pipeliner, member string, previous map[string]string, current map[string]string) {
+	for label, value := range previous {
+		if currentValue, ok := current[label]; !ok || currentValue != value {
+			pipe.SRem(ctx, s.labelValueKey(label, value), member)
+		}
+
+		if _, ok := current[label]; !ok {
+			pipe.SRem(ctx, s.labelKey(label), member)
+		}
+	}
+
+	for label, value := range current {
+		pipe.SAdd(ctx, s.labelValueKey(label, value), member)
+		pipe.SAdd(ctx, s.labelKey(label), member)
+	}
+}
+
+func (s *redisSecretStore) List(ctx context.Context, options ListOptions) ([]Secret, error) {
+	return s.ListPage(ctx, options, PageOptions{})
+}
+
+// ListPage seeks the cursor in the index of the listed order, and fetches the following secrets
+// until the page is full. When the selector has indexed requirements, the selected secrets are
+// sorted instead, as there are usually less of them than secrets.
+func (s *redisSecretStore) ListPage(ctx context.Context, options ListOptions, page PageOptions) ([]Secret, error) {
+	index := s.listIndex(options, page.OrderBy)
+	selected, indexed, err := s.selectLabels(ctx, options.Selector)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if indexed {
+		selected, err = s.sortSelected(ctx, index, selected)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	min := index.min
+
+	if page.After != nil {
+		cursor := index.member(namespacedKey(page.After.Namespace, page.After.Name), page.After.ExpiresAt)
+		min = "(" + cursor
+
+		selected = selected[sort.Search(len(selected), func(i int) bool {
+			return selected[i] > cursor
+		}):]
+	}
+
+	result := make([]Secret, 0)
+
+	for page.Size == 0 || len(result) < page.Size {
+		count := 0
+
+		if page.Size > 0 {
+			count = page.Size - len(result)
+		}
+
+		var batch []string
+
+		if indexed {
+			batch = selected
+
+			if count > 0 && len(batch) > count {
+				batch = batch[:count]
+			}
+
+			selected = selected[len(batch):]
+		} else {
+			batch, err = s.client.ZRangeByLex(ctx, index.key, &redis.ZRangeBy{Min: min, Max: index.max, Count: int64(count)}).Result()
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if len(batch) == 0 {
+			break
+		}
+
+		min = "(" + batch[len(batch)-1]
+		secrets, err := s.fetchMembers(ctx, index, batch)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// the requirements which are not indexed are checked once the secrets are fetched
+		for _, secret := range secrets {
+			if options.matches(secret) {
+				result = append(result, secret)
+			}
+		}
+
+		if count == 0 {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// redisListIndex is the index of the secrets of the listed namespaces in a given order, and the
+// range of its members listing them.
+type redisListIndex struct {
+	key      string
+	byExpiry bool
+	min      string
+	max      string
+
+	// prefix is the prefix of the members of the listed namespace, followed by the expiration date
+	// in the namespace expiry index.
+	prefix        string
+	allNamespaces bool
+}
+
+func (s *redisSecretStore) listIndex(options ListOptions, order ListOrder) redisListIndex {
+	index := redisListIndex{key: s.namesKey(), byExpiry: order == OrderByExpiry, min: "-", max: "+", allNamespaces: options.AllNamespaces}
+
+	if index.byExpiry {
+		index.key = s.namespaceExpiryKey()
+
+		if options.AllNamespaces {
+			index.key = s.expiryKey()
+		}
+	}
+
+	if !options.AllNamespaces {
+		// the namespaced keys of the default namespace are the names, and the other namespaces
+		// are between "\xff<namespace>\x00" and "\xff<namespace>\x01"
+		index.prefix = namespacedKey(options.Namespace, "")
+		index.min = "[" + index.prefix
+		index.max = "(\xff"
+
+		if options.Namespace != "" {
+			index.max = "(" + strings.TrimSuffix(index.prefix, "\x00") + "\x01"
+		}
+	}
+
+	return index
+}
+
+// member is the member of a secret in the index, given its namespaced key.
+func (i redisListIndex) member(key string, expiresAt time.Time) string {
+	if !i.byExpiry {
+		return key
+	}
+
+	return i.prefix + redisSortKey(expiresAt) + key[len(i.prefix):]
+}
+
+// secretKey is the namespaced key of the secret of a member of the index.
+func (i redisListIndex) secretKey(member string) string {
+	if !i.byExpiry {
+		return member
+	}
+
+	return member[:len(i.prefix)] + member[len(i.prefix)+redisSortKeyLength:]
+}
+
+func (i redisListIndex) contains(key string) bool {
+	return i.allNamespaces || (strings.HasPrefix(key, i.prefix) && (i.prefix != "" || !strings.HasPrefix(key, "\xff")))
+}
+
+// sortSelected returns the sorted members of the index of the selected secrets which are in the
+// listed namespace.
+func (s *redisSecretStore) sortSelected(ctx context.Context, index redisListIndex, selected []string) ([]string, error) {
+	keys := make([]string, 0, len(selected))
+
+	for _, key := range selected {
+		if index.contains(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	members := make([]string, 0, len(keys))
+
+	if !index.byExpiry {
+		members = append(members, keys...)
+		sort.Strings(members)
+
+		return members, nil
+	}
+
+	commands := make([]*redis.StringCmd, 0, len(keys))
+
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			commands = append(commands, pipe.HGet(ctx, s.secretKey(key), "expires_at"))
+		}
+
+		return nil
+	})
+
+	// the deleted secrets may be left in the label sets, and have no expiration date
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		if expiresAt, err := commands[i].Int64(); err == nil {
+			members = append(members, index.member(key, fromUnixNano(expiresAt)))
+		}
+	}
+
+	sort.Strings(members)
+
+	return members, nil
+}
+
+// fetchMembers fetches the secrets of the given members of the index, skipping the stale members
+// left by a secret deleted while it was saved.
+func (s *redisSecretStore) fetchMembers(ctx context.Context, index redisListIndex, members []string) ([]Secret, error) {
+	keys := make([]string, len(members))
+	listed := make(map[string]bool, len(members))
+
+	for i, member := range members {
+		keys[i] = index.secretKey(member)
+		listed[member] = true
+	}
+
+	secrets, err := s.fetchAll(ctx, keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := secrets[:0]
+
+	// the secret of a stale member is fetched along with the one of its current member, and only
+	// kept once
+	for _, secret := range secrets {
+		member := index.member(namespacedKey(secret.Namespace, secret.Name), secret.ExpiresAt)
+
+		if listed[member] {
+			result = append(result, secret)
+			delete(listed, member)
+		}
+	}
+
+	return result, nil
+}
+
+// selectLabels returns the namespaced keys of the secrets meeting the requirements of the selector
+// which can be answered by the label sets, telling whether there was any.
+func (s *redisSecretStore) selectLabels(ctx context.Context, selector labels.Selector) ([]string, bool, error) {
+	var commands []*redis.StringSliceCmd
+
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, requirement := range selectorRequirements(selector) {
+			var keys []string
+
+			switch requirement.Operator() {
+			case selection.Equals, selection.DoubleEquals, selection.In:
+				for _, value := range requirement.Values().List() {
+					keys = append(keys, s.labelValueKey(requirement.Key(), value))
+				}
+
+			case selection.Exists:
+				keys = append(keys, s.labelKey(requirement.Key()))
+
+			default:
+				continue
+			}
+
+			commands = append(commands, pipe.SUnion(ctx, keys...))
+		}
+
+		return nil
+	})
+
+	if err != nil || len(commands) == 0 {
+		return nil, false, err
+	}
+
+	// the members are intersected in the order of the first set, sorted so that the secrets are
+	// always listed in the same order
+	members := commands[0].Val()
+	sort.Strings(members)
+
+	for _, command := range commands[1:] {
+		found := make(map[string]bool, len(command.Val()))
+
+		for _, member := range command.Val() {
+			found[member] = true
+		}
+
+		intersection := members[:0]
+
+		for _, member := range members {
+			if found[member] {
+				intersection = append(intersection, member)
+			}
+		}
+
+		members = intersection
+	}
+
+	return members, true, nil
+}
+
+func (s *redisSecretStore) ListExpiringBefore(ctx context.Context, before time.Time, limit int) ([]Secret, error) {
+	index := s.listIndex(ListOptions{AllNamespaces: true}, OrderByExpiry)
+	members, err := s.client.ZRangeByLex(ctx, index.key, &redis.ZRangeBy{
+		Min:   "-",
+		Max:   "(" + redisSortKey(before),
+		Count: int64(limit),
+	}).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.fetchMembers(ctx, index, members)
+}
+
+func (s *redisSecretStore) Contains(ctx context.Context, namespace string, name string) (bool, error) {
+	count, err := s.client.Exists(ctx, s.secretKey(namespacedKey(namespace, name))).Result()
+
+	return count > 0, err
+}
+
+func (s *redisSecretStore) Fetch(ctx context.Context, namespace string, name string) (Secret, error) {
+	values, err := s.client.HGetAll(ctx, s.secretKey(namespacedKey(namespace, name))).Result()
+
+	if err != nil {
+		return Secret{}, err
+	}
+
+	if len(values) == 0 {
+		return Secret{}, ErrSecretNotFound
+	}
+
+	return decodeRedisSecret(values)
+}
+
+// fetchAll fetches the given secrets, by namespaced key, in a single round trip. Secrets deleted in
+// the meantime are skipped.
+func (s *redisSecretStore) fetchAll(ctx context.Context, members []string) ([]Secret, error) {
+	commands := make([]*redis.StringStringMapCmd, 0, len(members))
+
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, member := range members {
+			commands = append(commands, pipe.HGetAll(ctx, s.secretKey(member)))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Secret, 0, len(members))
+
+	for _, command := range commands {
+		if len(command.Val()) == 0 {
+			continue
+		}
+
+		secret, err := decodeRedisSecret(command.Val())
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, secret)
+	}
+
+	return result, nil
+}
+
+func decodeRedisSecret(values map[string]string) (Secret, error) {
+	secret := Secret{
+		Namespace: values["namespace"],
+		Name:      values["name"],
+		Token:     values["token"],
+	}
+
+	if err := json.Unmarshal([]byte(values["claims"]), &secret.Claims); err != nil {
+		return Secret{}, fmt.Errorf("couldn't decode claims of secret \"%s\" : %w", secret.Name, err)
+	}
+
+	if secret.Claims == nil {
+		secret.Claims = make(map[string]interface{})
+	}
+
+	if secretLabels, ok := values["labels"]; ok {
+		if err := json.Unmarshal([]byte(secretLabels), &secret.Labels); err != nil {
+			return Secret{}, fmt.Errorf("couldn't decode labels of secret \"%s\" : %w", secret.Name, err)
+		}
+	}
+
+	if history, ok := values["history"]; ok {
+		if err := json.Unmarshal([]byte(history), &secret.History); err != nil {
+			return Secret{}, fmt.Errorf("couldn't decode history of secret \"%s\" : %w", secret.Name, err)
+		}
+	}
+
+	if issuedTokens, ok := values["issued_tokens"]; ok {
+		if err := json.Unmarshal([]byte(issuedTokens), &secret.IssuedTokens); err != nil {
+			return Secret{}, fmt.Errorf("couldn't decode issued tokens of secret \"%s\" : %w", secret.Name, err)
+		}
+	}
+
+	expiresAt, err := strconv.ParseInt(values["expires_at"], 10, 64)
+
+	if err != nil {
+		return Secret{}, fmt.Errorf("couldn't decode expiration date of secret \"%s\" : %w", secret.Name, err)
+	}
+
+	renewedAt, _ := strconv.ParseInt(values["renewed_at"], 10, 64)
+	secret.Revision, _ = strconv.ParseUint(values["revision"], 10, 64)
+
+	ttl, _ := strconv.ParseInt(values["ttl"], 10, 64)
+	renewBefore, _ := strconv.ParseInt(values["renew_before"], 10, 64)
+
+	secret.TTL = time.Duration(ttl)
+	secret.RenewBefore = time.Duration(renewBefore)
+
+	secret.ExpiresAt = fromUnixNano(expiresAt)
+	secret.RenewedAt = fromUnixNano(renewedAt)
+
+	return secret, nil
+}
+
+const redisSortKeyLength = 16
+
+// redisSortKey encodes a date, in milliseconds, so that the dates are sorted lexicographically : the
+// sign bit is flipped so that the dates before 1970 come first, and the hexadecimal digits have a
+// fixed length.
+func redisSortKey(t time.Time) string {
+	return fmt.Sprintf("%016x", uint64(t.UnixMilli())^(1<<63))
+}
+
+// redisScore is the score of a date in the expiry sorted set. Milliseconds are precise enough, and
+// fit in the float64 used by redis for the scores.
+func redisScore(t time.Time) float64 {
+	return float64(t.UnixMilli())
+}
+
+// redisRevocationList keeps the revoked tokens in a hash of the JSON encoded tokens keyed by their
+// jti, along with a sorted set of their jti scored by their expiration date, so that the expired
+// tokens are found with a range query.
+type redisRevocationList struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func (s *redisSecretStore) Revocations() RevocationList {
+	return &redisRevocationList{client: s.client, prefix: s.prefix}
+}
+
+func (l *redisRevocationList) tokensKey() string {
+	return l.prefix + ":revoked"
+}
+
+func (l *redisRevocationList) expiryKey() string {
+	return l.prefix + ":revoked-expiry"
+}
+
+func (l *redisRevocationList) Revoke(ctx context.Context, token RevokedToken) error {
+	value, err := json.Marshal(token)
+
+	if err != nil {
+		return err
+	}
+
+	// the expired tokens are forgotten on each revocation
+	max := strconv.FormatFloat(redisScore(time.Now()), 'f', -1, 64)
+	expired, err := l.client.ZRangeByScore(ctx, l.expiryKey(), &redis.ZRangeBy{Min: "-inf", Max: max}).Result()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = l.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(expired) > 0 {
+			pipe.HDel(ctx, l.tokensKey(), expired...)
+			pipe.ZRem(ctx, l.expiryKey(), redisMembers(expired)...)
+		}
+
+		pipe.HSet(ctx, l.tokensKey(), token.ID, value)
+		pipe.ZAdd(ctx, l.expiryKey(), &redis.Z{Score: redisScore(token.ExpiresAt), Member: token.ID})
+
+		return nil
+	})
+
+	return err
+}
+
+func (l *redisRevocationList) Contains(ctx context.Context, id string) (bool, error) {
+	value, err := l.client.HGet(ctx, l.tokensKey(), id).Result()
+
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	var token RevokedToken
+
+	if err := json.Unmarshal([]byte(value), &token); err != nil {
+		return false, fmt.Errorf("couldn't decode revoked token : %w", err)
+	}
+
+	return token.ExpiresAt.After(time.Now()), nil
+}
+
+func (l *redisRevocationList) List(ctx context.Context) ([]RevokedToken, error) {
+	values, err := l.client.HVals(ctx, l.tokensKey()).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]RevokedToken, 0, len(values))
+	now := time.Now()
+
+	for _, value := range values {
+		var token RevokedToken
+
+		if err := json.Unmarshal([]byte(value), &token); err != nil {
+			return nil, fmt.Errorf("couldn't decode revoked token : %w", err)
+		}
+
+		if token.ExpiresAt.After(now) {
+			result = append(result, token)
+		}
+	}
+
+	sortRevokedTokens(result)
+
+	return result, nil
+}
+
+func redisMembers(values []string) []interface{} {
+	members := make([]interface{}, len(values))
+
+	for i, value := range values {
+		members[i] = value
+	}
+
+	return members
+}
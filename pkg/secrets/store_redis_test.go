@@ -0,0 +1,106 @@
+package secrets
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestRedisSecretStore(t *testing.T) SecretStore {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	t.Cleanup(func() { client.Close() })
+
+	return NewRedisSecretStore(client, "")
+}
+
+func TestRedisSecretStore(t *testing.T) {
+	testSecretStore(t, newTestRedisSecretStore(t))
+}
+
+func TestRedisRevocationList(t *testing.T) {
+	testRevocationList(t, newTestRedisSecretStore(t).(RevocationStore).Revocations())
+}
+
+func TestRedisSecretStoreListExpiringBefore(t *testing.T) {
+	ctx := context.TODO()
+	store := newTestRedisSecretStore(t)
+
+	store.Save(ctx, NewSecret("in 2 hours", 2*time.Hour))
+	store.Save(ctx, NewSecret("in 10 minutes", 10*time.Minute))
+	store.Save(ctx, NewSecret("expired", -time.Minute))
+
+	// a renewal moves the secret in the expiry index
+	renewed := NewSecret("renewed", -time.Minute)
+	store.Save(ctx, renewed)
+	renewed.ExpiresAt = time.Now().Add(3 * time.Hour)
+	store.Save(ctx, renewed)
+
+	secrets, err := store.ListExpiringBefore(ctx, time.Now().Add(time.Hour), 0)
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if len(secrets) != 2 || secrets[0].Name != "expired" || secrets[1].Name != "in 10 minutes" {
+		t.Fatalf("Expected [expired, in 10 minutes], got %v", secrets)
+	}
+
+	store.Delete(ctx, "", "expired")
+
+	secrets, _ = store.ListExpiringBefore(ctx, time.Now().Add(time.Hour), 0)
+
+	if len(secrets) != 1 {
+		t.Fatalf("Deleted secrets should be removed from the expiry index, got %v", secrets)
+	}
+}
+
+func TestRedisSecretStoreKeys(t *testing.T) {
+	ctx := context.TODO()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	t.Cleanup(func() { client.Close() })
+
+	store := NewRedisSecretStore(client, "")
+	secret := NewSecret("foo", time.Hour)
+	secret.Labels = map[string]string{"game": "foo"}
+
+	store.Save(ctx, secret)
+	store.(RevocationStore).Revocations().Revoke(ctx, RevokedToken{ID: "foo", ExpiresAt: time.Now().Add(time.Hour)})
+
+	// every key is in the same slot of a cluster
+	for _, key := range server.Keys() {
+		if !strings.HasPrefix(key, "{secrets}:") {
+			t.Fatalf("Expected every key to start with the \"{secrets}\" hash tag, got %s", key)
+		}
+	}
+
+	// a member left in the indexes by a secret deleted while it was renewed is skipped
+	stale := store.(*redisSecretStore).indexMembers("", "foo", time.Now().Add(-time.Hour))
+
+	for key, member := range stale {
+		client.ZAdd(ctx, key, &redis.Z{Member: member})
+	}
+
+	for _, order := range []ListOrder{OrderByName, OrderByExpiry} {
+		secrets, err := store.ListPage(ctx, ListOptions{}, PageOptions{OrderBy: order, Size: 10})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if len(secrets) != 1 {
+			t.Fatalf("Expected the secret to be listed once, got %v", secrets)
+		}
+	}
+
+	if secrets, _ := store.ListExpiringBefore(ctx, time.Now(), 0); len(secrets) != 0 {
+		t.Fatalf("Expected no expired secret, got %v", secrets)
+	}
+}
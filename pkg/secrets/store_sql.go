@@ -0,0 +1,722 @@
+package secrets
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// sqlDialects holds the schema migrations of each supported database. They are applied in order,
+// and the ones already applied are recorded in the schema_migrations table.
+//
+// Dates are stored as unix timestamps in nanoseconds, so that they are handled the same way by
+// every driver.
+var sqlDialects = map[string][]string{
+	"sqlite": {
+		`CREATE TABLE secrets (
+			name TEXT NOT NULL PRIMARY KEY,
+			token TEXT NOT NULL,
+			claims TEXT NOT NULL,
+			expires_at BIGINT NOT NULL,
+			renewed_at BIGINT NOT NULL
+		)`,
+		`CREATE INDEX secrets_expires_at ON secrets (expires_at)`,
+		`ALTER TABLE secrets ADD COLUMN revision BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE secrets ADD COLUMN history TEXT NOT NULL DEFAULT '[]'`,
+		`ALTER TABLE secrets ADD COLUMN ttl BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE secrets ADD COLUMN renew_before BIGINT NOT NULL DEFAULT 0`,
+		// sqlite can't change the primary key of a table, which has to be rebuilt
+		`CREATE TABLE secrets_namespaced (
+			namespace TEXT NOT NULL DEFAULT '',
+			name TEXT NOT NULL,
+			token TEXT NOT NULL,
+			claims TEXT NOT NULL,
+			expires_at BIGINT NOT NULL,
+			renewed_at BIGINT NOT NULL,
+			revision BIGINT NOT NULL DEFAULT 0,
+			history TEXT NOT NULL DEFAULT '[]',
+			ttl BIGINT NOT NULL DEFAULT 0,
+			renew_before BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (namespace, name)
+		)`,
+		`INSERT INTO secrets_namespaced (name, token, claims, expires_at, renewed_at, revision, history, ttl, renew_before)
+			SELECT name, token, claims, expires_at, renewed_at, revision, history, ttl, renew_before FROM secrets`,
+		`DROP TABLE secrets`,
+		`ALTER TABLE secrets_namespaced RENAME TO secrets`,
+		`CREATE INDEX secrets_expires_at ON secrets (expires_at)`,
+		`ALTER TABLE secrets ADD COLUMN labels TEXT NOT NULL DEFAULT '{}'`,
+		`CREATE TABLE secret_labels (
+			namespace TEXT NOT NULL,
+			name TEXT NOT NULL,
+			label TEXT NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (namespace, name, label)
+		)`,
+		`CREATE INDEX secret_labels_label_value ON secret_labels (label, value)`,
+		`CREATE TABLE revoked_tokens (
+			id TEXT NOT NULL PRIMARY KEY,
+			namespace TEXT NOT NULL,
+			name TEXT NOT NULL,
+			expires_at BIGINT NOT NULL,
+			revoked_at BIGINT NOT NULL
+		)`,
+		`CREATE INDEX revoked_tokens_expires_at ON revoked_tokens (expires_at)`,
+		`ALTER TABLE secrets ADD COLUMN issued_tokens TEXT NOT NULL DEFAULT '[]'`,
+	},
+	"postgres": {
+		`CREATE TABLE secrets (
+			name TEXT NOT NULL PRIMARY KEY,
+			token TEXT NOT NULL,
+			claims JSONB NOT NULL,
+			expires_at BIGINT NOT NULL,
+			renewed_at BIGINT NOT NULL
+		)`,
+		`CREATE INDEX secrets_expires_at ON secrets (expires_at)`,
+		`ALTER TABLE secrets ADD COLUMN revision BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE secrets ADD COLUMN history JSONB NOT NULL DEFAULT '[]'`,
+		`ALTER TABLE secrets ADD COLUMN ttl BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE secrets ADD COLUMN renew_before BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE secrets ADD COLUMN namespace TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE secrets DROP CONSTRAINT secrets_pkey`,
+		`ALTER TABLE secrets ADD PRIMARY KEY (namespace, name)`,
+		`ALTER TABLE secrets ADD COLUMN labels JSONB NOT NULL DEFAULT '{}'`,
+		`CREATE TABLE secret_labels (
+			namespace TEXT NOT NULL,
+			name TEXT NOT NULL,
+			label TEXT NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (namespace, name, label)
+		)`,
+		`CREATE INDEX secret_labels_label_value ON secret_labels (label, value)`,
+		`CREATE TABLE revoked_tokens (
+			id TEXT NOT NULL PRIMARY KEY,
+			namespace TEXT NOT NULL,
+			name TEXT NOT NULL,
+			expires_at BIGINT NOT NULL,
+			revoked_at BIGINT NOT NULL
+		)`,
+		`CREATE INDEX revoked_tokens_expires_at ON revoked_tokens (expires_at)`,
+		`ALTER TABLE secrets ADD COLUMN issued_tokens JSONB NOT NULL DEFAULT '[]'`,
+	},
+}
+
+// sqlSecretColumns are the columns written on each save, the revision being handled by the store.
+var sqlSecretColumns = []string{"namespace", "name", "token", "claims", "expires_at", "renewed_at", "history", "ttl", "renew_before", "labels", "issued_tokens"}
+
+var sqlSelectSecret = `SELECT ` + strings.Join(sqlSecretColumns, ", ") + `, revision FROM secrets`
+
+// sqlSecretStore stores the secrets in a SQL database, with the claims, the labels and the history
+// JSON encoded. The labels are also indexed by the secret_labels table, so that the label selectors
+// are applied by the database.
+type sqlSecretStore struct {
+	db *sql.DB
+}
+
+// NewSQLSecretStore creates a store using an already opened database of the given dialect
+// ("sqlite" or "postgres"), migrating its schema if needed.
+func NewSQLSecretStore(ctx context.Context, db *sql.DB, dialect string) (SecretStore, error) {
+	migrations, ok := sqlDialects[dialect]
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported sql dialect \"%s\"", dialect)
+	}
+
+	if err := migrateSQLSecretStore(ctx, db, migrations); err != nil {
+		return nil, fmt.Errorf("couldn't migrate database : %w", err)
+	}
+
+	return &sqlSecretStore{db: db}, nil
+}
+
+// SQLiteDSN is the data source name of the sqlite database at path, set up to be shared : writers
+// wait for each other instead of failing with SQLITE_BUSY, and readers don't block them.
+func SQLiteDSN(path string) string {
+	return path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+}
+
+func migrateSQLSecretStore(ctx context.Context, db *sql.DB, migrations []string) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL PRIMARY KEY)`)
+
+	if err != nil {
+		return err
+	}
+
+	for version, migration := range migrations {
+		tx, err := db.BeginTx(ctx, nil)
+
+		if err != nil {
+			return err
+		}
+
+		var applied int
+		err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE version = $1`, version+1).Scan(&applied)
+
+		if err == nil && applied == 0 {
+			if _, err = tx.ExecContext(ctx, migration); err == nil {
+				_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version+1)
+			}
+		}
+
+		if err != nil {
+			tx.Rollback()
+
+			return fmt.Errorf("migration %d : %w", version+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Save saves the secret and its labels in a single transaction, so that the labels index never
+// differs from the secrets.
+func (s *sqlSecretStore) Save(ctx context.Context, in Secret) error {
+	return s.SaveAll(ctx, []Secret{in})
+}
+
+func (s *sqlSecretStore) SaveAll(ctx context.Context, secrets []Secret) error {
+	return s.saveAll(ctx, secrets, false)
+}
+
+func (s *sqlSecretStore) Create(ctx context.Context, in Secret) error {
+	return s.CreateAll(ctx, []Secret{in})
+}
+
+func (s *sqlSecretStore) CreateAll(ctx context.Context, secrets []Secret) error {
+	return s.saveAll(ctx, secrets, true)
+}
+
+func (s *sqlSecretStore) saveAll(ctx context.Context, secrets []Secret, create bool) error {
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		for _, in := range secrets {
+			if err := s.save(ctx, tx, in, create); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// transaction runs the queries in a transaction, which is rolled back if they fail.
+func (s *sqlSecretStore) transaction(ctx context.Context, queries func(*sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	if err := queries(tx); err != nil {
+		tx.Rollback()
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlSecretStore) save(ctx context.Context, tx *sql.Tx, in Secret, create bool) error {
+	values, err := sqlSecretValues(in)
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case create:
+		err = s.insert(ctx, tx, values)
+	case in.Revision != 0:
+		err = s.update(ctx, tx, in, values)
+	default:
+		err = s.upsert(ctx, tx, values)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return saveSQLLabels(ctx, tx, in)
+}
+
+// upsert saves the secret, whatever its stored revision.
+func (s *sqlSecretStore) upsert(ctx context.Context, tx *sql.Tx, values []interface{}) error {
+	placeholders := make([]string, len(sqlSecretColumns))
+	updates := make([]string, len(sqlSecretColumns))
+
+	for i, column := range sqlSecretColumns {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		updates[i] = column + " = excluded." + column
+	}
+
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO secrets (`+strings.Join(sqlSecretColumns, ", ")+`, revision) VALUES (`+strings.Join(placeholders, ", ")+`, 1)
+		ON CONFLICT (namespace, name) DO UPDATE SET `+strings.Join(updates, ", ")+`, revision = secrets.revision + 1`,
+		values...,
+	)
+
+	return err
+}
+
+// insert saves the secret only if it isn't stored yet.
+func (s *sqlSecretStore) insert(ctx context.Context, tx *sql.Tx, values []interface{}) error {
+	placeholders := make([]string, len(sqlSecretColumns))
+
+	for i := range sqlSecretColumns {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	result, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO secrets (`+strings.Join(sqlSecretColumns, ", ")+`, revision) VALUES (`+strings.Join(placeholders, ", ")+`, 1)
+		ON CONFLICT (namespace, name) DO NOTHING`,
+		values...,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if inserted == 0 {
+		return ErrSecretExists
+	}
+
+	return nil
+}
+
+// update saves the secret only if its revision is still the stored one.
+func (s *sqlSecretStore) update(ctx context.Context, tx *sql.Tx, in Secret, values []interface{}) error {
+	updates := make([]string, len(sqlSecretColumns))
+
+	for i, column := range sqlSecretColumns {
+		updates[i] = fmt.Sprintf("%s = $%d", column, i+1)
+	}
+
+	result, err := tx.ExecContext(
+		ctx,
+		`UPDATE secrets SET `+strings.Join(updates, ", ")+`, revision = revision + 1
+		WHERE namespace = $1 AND name = $2 AND revision = `+fmt.Sprintf("$%d", len(values)+1),
+		append(values, in.Revision)...,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return ErrSecretConflict
+	}
+
+	return nil
+}
+
+func (s *sqlSecretStore) Delete(ctx context.Context, namespace string, name string) error {
+	return s.DeleteAll(ctx, []Secret{{Namespace: namespace, Name: name}})
+}
+
+func (s *sqlSecretStore) DeleteAll(ctx context.Context, secrets []Secret) error {
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		for _, in := range secrets {
+			_, err := tx.ExecContext(ctx, `DELETE FROM secrets WHERE namespace = $1 AND name = $2`, in.Namespace, in.Name)
+
+			if err == nil {
+				_, err = tx.ExecContext(ctx, `DELETE FROM secret_labels WHERE namespace = $1 AND name = $2`, in.Namespace, in.Name)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *sqlSecretStore) List(ctx context.Context, options ListOptions) ([]Secret, error) {
+	return s.ListPage(ctx, options, PageOptions{})
+}
+
+// ListPage filters and sorts the secrets in the database, the page starting after the position of
+// the cursor. As some label requirements are only checked once the secrets are fetched, the
+// following rows are queried until the page is full.
+func (s *sqlSecretStore) ListPage(ctx context.Context, options ListOptions, page PageOptions) ([]Secret, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	if !options.AllNamespaces {
+		args = append(args, options.Namespace)
+		conditions = append(conditions, `namespace = $1`)
+	}
+
+	for _, requirement := range selectorRequirements(options.Selector) {
+		condition, conditionArgs, ok := sqlLabelCondition(requirement, len(args))
+
+		if ok {
+			conditions = append(conditions, condition)
+			args = append(args, conditionArgs...)
+		}
+	}
+
+	order := `namespace, name`
+
+	if page.OrderBy == OrderByExpiry {
+		order = `expires_at, namespace, name`
+	}
+
+	result := make([]Secret, 0)
+
+	for after := page.After; ; {
+		query, queryArgs := sqlPageQuery(conditions, args, order, after, page)
+		secrets, err := s.query(ctx, query, queryArgs...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, secret := range secrets {
+			if page.Size > 0 && len(result) == page.Size {
+				break
+			}
+
+			if options.matches(secret) {
+				result = append(result, secret)
+			}
+		}
+
+		if page.Size == 0 || len(result) == page.Size || len(secrets) < page.Size {
+			return result, nil
+		}
+
+		cursor := newPageCursor(secrets[len(secrets)-1])
+		after = &cursor
+	}
+}
+
+// sqlPageQuery returns the query selecting the rows following the cursor, in the given order.
+func sqlPageQuery(conditions []string, args []interface{}, order string, after *PageCursor, page PageOptions) (string, []interface{}) {
+	conditions = append([]string(nil), conditions...)
+	args = append([]interface{}(nil), args...)
+
+	switch {
+	case after != nil && page.OrderBy == OrderByExpiry:
+		args = append(args, unixNano(after.ExpiresAt), after.Namespace, after.Name)
+		conditions = append(conditions, fmt.Sprintf(`(expires_at, namespace, name) > ($%d, $%d, $%d)`, len(args)-2, len(args)-1, len(args)))
+
+	case after != nil:
+		args = append(args, after.Namespace, after.Name)
+		conditions = append(conditions, fmt.Sprintf(`(namespace, name) > ($%d, $%d)`, len(args)-1, len(args)))
+	}
+
+	query := sqlSelectSecret
+
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+
+	query += ` ORDER BY ` + order
+
+	if page.Size > 0 {
+		args = append(args, page.Size)
+		query += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+
+	return query, args
+}
+
+func (s *sqlSecretStore) ListExpiringBefore(ctx context.Context, before time.Time, limit int) ([]Secret, error) {
+	query := sqlSelectSecret + ` WHERE expires_at < $1 ORDER BY expires_at, namespace, name`
+
+	if limit > 0 {
+		return s.query(ctx, query+` LIMIT $2`, unixNano(before), limit)
+	}
+
+	return s.query(ctx, query, unixNano(before))
+}
+
+func (s *sqlSecretStore) Contains(ctx context.Context, namespace string, name string) (bool, error) {
+	_, err := s.Fetch(ctx, namespace, name)
+
+	if errors.Is(err, ErrSecretNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *sqlSecretStore) Fetch(ctx context.Context, namespace string, name string) (Secret, error) {
+	secret, err := scanSQLSecret(s.db.QueryRowContext(ctx, sqlSelectSecret+` WHERE namespace = $1 AND name = $2`, namespace, name))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Secret{}, ErrSecretNotFound
+	}
+
+	return secret, err
+}
+
+func (s *sqlSecretStore) query(ctx context.Context, query string, args ...interface{}) ([]Secret, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	result := make([]Secret, 0)
+
+	for rows.Next() {
+		secret, err := scanSQLSecret(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, secret)
+	}
+
+	return result, rows.Err()
+}
+
+// saveSQLLabels replaces the indexed labels of the secret by its current ones.
+func saveSQLLabels(ctx context.Context, tx *sql.Tx, in Secret) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM secret_labels WHERE namespace = $1 AND name = $2`, in.Namespace, in.Name); err != nil {
+		return err
+	}
+
+	for label, value := range in.Labels {
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO secret_labels (namespace, name, label, value) VALUES ($1, $2, $3, $4)`,
+			in.Namespace, in.Name, label, value,
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sqlLabelCondition returns the condition matching the secrets meeting a label requirement, its
+// placeholders being numbered after the given number of arguments. The numeric comparisons ("gt"
+// and "lt") are not expressed in SQL.
+func sqlLabelCondition(requirement labels.Requirement, argsCount int) (string, []interface{}, bool) {
+	args := []interface{}{requirement.Key()}
+	condition := fmt.Sprintf(
+		`EXISTS (SELECT 1 FROM secret_labels WHERE secret_labels.namespace = secrets.namespace AND secret_labels.name = secrets.name AND secret_labels.label = $%d`,
+		argsCount+1,
+	)
+
+	if values := requirement.Values().List(); len(values) > 0 {
+		placeholders := make([]string, len(values))
+
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = fmt.Sprintf("$%d", argsCount+len(args))
+		}
+
+		condition += ` AND secret_labels.value IN (` + strings.Join(placeholders, ", ") + `)`
+	}
+
+	condition += `)`
+
+	switch requirement.Operator() {
+	case selection.Equals, selection.DoubleEquals, selection.In, selection.Exists:
+		return condition, args, true
+
+	case selection.NotEquals, selection.NotIn, selection.DoesNotExist:
+		return `NOT ` + condition, args, true
+	}
+
+	return "", nil, false
+}
+
+// sqlSecretValues returns the values of the secret, following the order of sqlSecretColumns.
+func sqlSecretValues(in Secret) ([]interface{}, error) {
+	claims, err := json.Marshal(in.Claims)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode claims : %w", err)
+	}
+
+	history, err := json.Marshal(in.History)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode history : %w", err)
+	}
+
+	issuedTokens, err := json.Marshal(in.IssuedTokens)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode issued tokens : %w", err)
+	}
+
+	secretLabels := in.Labels
+
+	if secretLabels == nil {
+		secretLabels = map[string]string{}
+	}
+
+	encodedLabels, err := json.Marshal(secretLabels)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode labels : %w", err)
+	}
+
+	return []interface{}{
+		in.Namespace,
+		in.Name,
+		in.Token,
+		string(claims),
+		unixNano(in.ExpiresAt),
+		unixNano(in.RenewedAt),
+		string(history),
+		int64(in.TTL),
+		int64(in.RenewBefore),
+		string(encodedLabels),
+		string(issuedTokens),
+	}, nil
+}
+
+// scanSQLSecret scans a row selected with sqlSelectSecret.
+func scanSQLSecret(row interface{ Scan(...interface{}) error }) (Secret, error) {
+	var (
+		secret       Secret
+		claims       []byte
+		history      []byte
+		secretLabels []byte
+		issuedTokens []byte
+		expiresAt    int64
+		renewedAt    int64
+	)
+
+	err := row.Scan(
+		&secret.Namespace,
+		&secret.Name,
+		&secret.Token,
+		&claims,
+		&expiresAt,
+		&renewedAt,
+		&history,
+		&secret.TTL,
+		&secret.RenewBefore,
+		&secretLabels,
+		&issuedTokens,
+		&secret.Revision,
+	)
+
+	if err != nil {
+		return Secret{}, err
+	}
+
+	if err := json.Unmarshal(claims, &secret.Claims); err != nil {
+		return Secret{}, fmt.Errorf("couldn't decode claims of secret \"%s\" : %w", secret.Name, err)
+	}
+
+	if err := json.Unmarshal(history, &secret.History); err != nil {
+		return Secret{}, fmt.Errorf("couldn't decode history of secret \"%s\" : %w", secret.Name, err)
+	}
+
+	if err := json.Unmarshal(secretLabels, &secret.Labels); err != nil {
+		return Secret{}, fmt.Errorf("couldn't decode labels of secret \"%s\" : %w", secret.Name, err)
+	}
+
+	if err := json.Unmarshal(issuedTokens, &secret.IssuedTokens); err != nil {
+		return Secret{}, fmt.Errorf("couldn't decode issued tokens of secret \"%s\" : %w", secret.Name, err)
+	}
+
+	if secret.Claims == nil {
+		secret.Claims = make(map[string]interface{})
+	}
+
+	secret.ExpiresAt = fromUnixNano(expiresAt)
+	secret.RenewedAt = fromUnixNano(renewedAt)
+
+	return secret, nil
+}
+
+// sqlRevocationList keeps the revoked tokens in the revoked_tokens table of the store's database.
+type sqlRevocationList struct {
+	store *sqlSecretStore
+}
+
+func (s *sqlSecretStore) Revocations() RevocationList {
+	return &sqlRevocationList{store: s}
+}
+
+func (l *sqlRevocationList) Revoke(ctx context.Context, token RevokedToken) error {
+	return l.store.transaction(ctx, func(tx *sql.Tx) error {
+		// the expired tokens are forgotten on each revocation
+		if _, err := tx.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at <= $1`, unixNano(time.Now())); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO revoked_tokens (id, namespace, name, expires_at, revoked_at) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (id) DO UPDATE SET namespace = excluded.namespace, name = excluded.name, expires_at = excluded.expires_at, revoked_at = excluded.revoked_at`,
+			token.ID, token.Namespace, token.Name, unixNano(token.ExpiresAt), unixNano(token.RevokedAt),
+		)
+
+		return err
+	})
+}
+
+func (l *sqlRevocationList) Contains(ctx context.Context, id string) (bool, error) {
+	var count int
+	err := l.store.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM revoked_tokens WHERE id = $1 AND expires_at > $2`, id, unixNano(time.Now())).Scan(&count)
+
+	return count > 0, err
+}
+
+func (l *sqlRevocationList) List(ctx context.Context) ([]RevokedToken, error) {
+	rows, err := l.store.db.QueryContext(ctx, `SELECT id, namespace, name, expires_at, revoked_at FROM revoked_tokens WHERE expires_at > $1 ORDER BY revoked_at`, unixNano(time.Now()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var result []RevokedToken
+
+	for rows.Next() {
+		var token RevokedToken
+		var expiresAt, revokedAt int64
+
+		if err := rows.Scan(&token.ID, &token.Namespace, &token.Name, &expiresAt, &revokedAt); err != nil {
+			return nil, err
+		}
+
+		token.ExpiresAt = fromUnixNano(expiresAt)
+		token.RevokedAt = fromUnixNano(revokedAt)
+		result = append(result, token)
+	}
+
+	return result, rows.Err()
+}
@@ -0,0 +1,217 @@
+package secrets
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Taluu/challenge-jwt/generated/infrapb"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+func newTestSQLSecretStore(t *testing.T, path string) SecretStore {
+	db, err := sql.Open("sqlite", SQLiteDSN(path))
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewSQLSecretStore(context.TODO(), db, "sqlite")
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	return store
+}
+
+func newTestPostgresSecretStore(t *testing.T, dsn string) SecretStore {
+	db, err := sql.Open("postgres", dsn)
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewSQLSecretStore(context.TODO(), db, "postgres")
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	return store
+}
+
+// testPostgresDSN returns the connection URL of the database given by SECRETS_TEST_POSTGRES_DSN,
+// skipping the test if it's not set. Each test gets a schema of its own, dropped once it's done.
+func testPostgresDSN(t *testing.T) string {
+	dsn := os.Getenv("SECRETS_TEST_POSTGRES_DSN")
+
+	if dsn == "" {
+		t.Skip("SECRETS_TEST_POSTGRES_DSN is not set")
+	}
+
+	dsnURL, err := url.Parse(dsn)
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	schema := fmt.Sprintf("secrets_test_%d", time.Now().UnixNano())
+
+	if _, err := db.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		db.Close()
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	t.Cleanup(func() {
+		db.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		db.Close()
+	})
+
+	// unknown parameters are set on each connection by the driver
+	query := dsnURL.Query()
+	query.Set("search_path", schema)
+	dsnURL.RawQuery = query.Encode()
+
+	return dsnURL.String()
+}
+
+// testSQLDialects runs the test on a database of each dialect : a sqlite one, and a postgres one if
+// SECRETS_TEST_POSTGRES_DSN is set. The test opens stores with open, each one using the same
+// database.
+func testSQLDialects(t *testing.T, test func(t *testing.T, open func() SecretStore)) {
+	t.Run("sqlite", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "secrets.db")
+
+		test(t, func() SecretStore { return newTestSQLSecretStore(t, path) })
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dsn := testPostgresDSN(t)
+
+		test(t, func() SecretStore { return newTestPostgresSecretStore(t, dsn) })
+	})
+}
+
+func TestSQLSecretStore(t *testing.T) {
+	testSQLDialects(t, func(t *testing.T, open func() SecretStore) {
+		testSecretStore(t, open())
+	})
+}
+
+func TestSQLRevocationList(t *testing.T) {
+	testSQLDialects(t, func(t *testing.T, open func() SecretStore) {
+		testRevocationList(t, open().(RevocationStore).Revocations())
+	})
+}
+
+func TestSQLSecretStoreMigrations(t *testing.T) {
+	ctx := context.TODO()
+
+	testSQLDialects(t, func(t *testing.T, open func() SecretStore) {
+		store := open()
+		store.Save(ctx, NewSecret("foo", time.Hour))
+
+		// migrations already applied are not applied again
+		store = open()
+
+		if contains, _ := store.Contains(ctx, "", "foo"); !contains {
+			t.Fatal("Secret should have been kept after migrating again")
+		}
+	})
+
+	if _, err := NewSQLSecretStore(ctx, nil, "oracle"); err == nil {
+		t.Fatal("Expected an error for an unsupported dialect")
+	}
+}
+
+func TestSQLSecretStoreListExpiringBefore(t *testing.T) {
+	ctx := context.TODO()
+
+	testSQLDialects(t, func(t *testing.T, open func() SecretStore) {
+		store := open()
+
+		store.Save(ctx, NewSecret("in 2 hours", 2*time.Hour))
+		store.Save(ctx, NewSecret("in 10 minutes", 10*time.Minute))
+		store.Save(ctx, NewSecret("expired", -time.Minute))
+
+		secrets, err := store.ListExpiringBefore(ctx, time.Now().Add(time.Hour), 0)
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if len(secrets) != 2 || secrets[0].Name != "expired" || secrets[1].Name != "in 10 minutes" {
+			t.Fatalf("Expected [expired, in 10 minutes], got %v", secrets)
+		}
+	})
+}
+
+func TestSQLiteConcurrentWrites(t *testing.T) {
+	ctx := context.TODO()
+	store := newTestSQLSecretStore(t, filepath.Join(t.TempDir(), "secrets.db"))
+	service, err := NewService(store, Config{SigningKey: []byte(testSigningKey)})
+
+	if err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	if _, err := service.Create(ctx, &infrapb.Secret{Name: "a"}); err != nil {
+		t.Fatalf("Unexpected error : %s", err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		updating = make(chan struct{})
+	)
+
+	// the secret is always near its expiration, so that the renewer keeps saving it
+	go func() {
+		for {
+			select {
+			case <-updating:
+				return
+			default:
+				service.renewExpiredSecrets(ctx, service.keyring, 2*defaultTTL, defaultTTL)
+			}
+		}
+	}()
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 30; j++ {
+				if _, err := service.Update(ctx, &infrapb.Secret{Name: "a", Claims: map[string]string{fmt.Sprintf("claim %d-%d", i, j): "value"}}); err != nil {
+					t.Errorf("Unexpected error : %s", err)
+				}
+
+				if _, err := store.Fetch(ctx, "", "a"); err != nil {
+					t.Errorf("Unexpected error : %s", err)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(updating)
+}
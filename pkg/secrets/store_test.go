@@ -0,0 +1,498 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// testSecretStore checks the behaviour every SecretStore implementation must have.
+func testSecretStore(t *testing.T, store SecretStore) {
+	ctx := context.TODO()
+
+	t.Run("save and fetch", func(t *testing.T) {
+		secret := NewSecret("foo", time.Hour)
+		secret.Token = "token"
+		secret.RenewedAt = time.Now()
+		secret.Claims = map[string]interface{}{"Foo": "bar"}
+		secret.History = []SecretVersion{{Version: 1, Claims: map[string]interface{}{"Foo": "baz"}, Author: "tester"}}
+		secret.IssuedTokens = []IssuedToken{{ID: "jti", ExpiresAt: time.Unix(secret.ExpiresAt.Unix(), 0)}}
+		secret.TTL = 2 * time.Hour
+		secret.RenewBefore = 10 * time.Minute
+
+		if err := store.Save(ctx, secret); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		fetched, err := store.Fetch(ctx, "", "foo")
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if fetched.Name != "foo" || fetched.Token != "token" || fetched.Claims["Foo"] != "bar" {
+			t.Fatalf("Fetched secret differs from the saved one : %v", fetched)
+		}
+
+		if !fetched.ExpiresAt.Equal(secret.ExpiresAt) || !fetched.RenewedAt.Equal(secret.RenewedAt) {
+			t.Fatalf("Fetched dates differ from the saved ones : %v", fetched)
+		}
+
+		if fetched.TTL != 2*time.Hour || fetched.RenewBefore != 10*time.Minute {
+			t.Fatalf("Fetched lifetime differs from the saved one : %v", fetched)
+		}
+
+		if len(fetched.History) != 1 || fetched.History[0].Claims["Foo"] != "baz" || fetched.History[0].Author != "tester" {
+			t.Fatalf("Fetched history differs from the saved one : %v", fetched.History)
+		}
+
+		if len(fetched.IssuedTokens) != 1 || !fetched.IssuedTokens[0].ExpiresAt.Equal(secret.IssuedTokens[0].ExpiresAt) || fetched.IssuedTokens[0].ID != "jti" {
+			t.Fatalf("Fetched issued tokens differ from the saved ones : %v", fetched.IssuedTokens)
+		}
+
+		if contains, err := store.Contains(ctx, "", "foo"); err != nil || !contains {
+			t.Fatalf("Store should contain the saved secret (%v)", err)
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		secret := NewSecret("foo", time.Hour)
+		secret.Token = "new token"
+
+		if err := store.Save(ctx, secret); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		fetched, _ := store.Fetch(ctx, "", "foo")
+
+		if fetched.Token != "new token" || len(fetched.Claims) != 0 {
+			t.Fatalf("Secret should have been overwritten, got %v", fetched)
+		}
+	})
+
+	t.Run("conditional save", func(t *testing.T) {
+		secret, _ := store.Fetch(ctx, "", "foo")
+
+		if secret.Revision == 0 {
+			t.Fatal("Saved secrets should have a revision")
+		}
+
+		stale := secret
+		secret.Token = "conditional token"
+
+		if err := store.Save(ctx, secret); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		fetched, _ := store.Fetch(ctx, "", "foo")
+
+		if fetched.Token != "conditional token" || fetched.Revision != secret.Revision+1 {
+			t.Fatalf("Secret should have been saved with the next revision, got %v", fetched)
+		}
+
+		stale.Token = "stale token"
+
+		if err := store.Save(ctx, stale); !errors.Is(err, ErrSecretConflict) {
+			t.Fatalf("Expected %s, got %v", ErrSecretConflict, err)
+		}
+
+		deleted := NewSecret("not existing", time.Hour)
+		deleted.Revision = 1
+
+		if err := store.Save(ctx, deleted); !errors.Is(err, ErrSecretConflict) {
+			t.Fatalf("Expected %s, got %v", ErrSecretConflict, err)
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		created := NewSecret("created", time.Hour)
+
+		if err := store.Create(ctx, created); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		existing := NewSecret("created", time.Hour)
+		existing.Token = "overwritten token"
+
+		if err := store.Create(ctx, existing); !errors.Is(err, ErrSecretExists) {
+			t.Fatalf("Expected %s, got %v", ErrSecretExists, err)
+		}
+
+		if fetched, _ := store.Fetch(ctx, "", "created"); fetched.Token != created.Token || fetched.Revision != 1 {
+			t.Fatalf("An existing secret should not be overwritten by a creation, got %v", fetched)
+		}
+
+		store.Delete(ctx, "", "created")
+	})
+
+	t.Run("not existing", func(t *testing.T) {
+		if _, err := store.Fetch(ctx, "", "not existing"); !errors.Is(err, ErrSecretNotFound) {
+			t.Fatalf("Expected %s, got %v", ErrSecretNotFound, err)
+		}
+
+		if contains, err := store.Contains(ctx, "", "not existing"); err != nil || contains {
+			t.Fatalf("Store should not contain an unsaved secret (%v)", err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		store.Save(ctx, NewSecret("bar", time.Hour))
+		store.Save(ctx, NewSecret("My Secret", time.Hour))
+
+		secrets, err := store.List(ctx, ListOptions{})
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		names := make([]string, 0, len(secrets))
+
+		for _, secret := range secrets {
+			names = append(names, secret.Name)
+		}
+
+		sort.Strings(names)
+
+		if len(names) != 3 || names[0] != "My Secret" || names[1] != "bar" || names[2] != "foo" {
+			t.Fatalf("Expected [My Secret bar foo], got %v", names)
+		}
+	})
+
+	t.Run("list expiring before", func(t *testing.T) {
+		store.Save(ctx, NewSecret("expired", -time.Minute))
+		store.Save(ctx, NewSecret("in 10 minutes", 10*time.Minute))
+
+		secrets, err := store.ListExpiringBefore(ctx, time.Now().Add(30*time.Minute), 0)
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if len(secrets) != 2 || secrets[0].Name != "expired" || secrets[1].Name != "in 10 minutes" {
+			t.Fatalf("Expected [expired, in 10 minutes], got %v", secrets)
+		}
+
+		secrets, _ = store.ListExpiringBefore(ctx, time.Now().Add(30*time.Minute), 1)
+
+		if len(secrets) != 1 || secrets[0].Name != "expired" {
+			t.Fatalf("Expected [expired], got %v", secrets)
+		}
+
+		store.Delete(ctx, "", "expired")
+		store.Delete(ctx, "", "in 10 minutes")
+
+		secrets, _ = store.ListExpiringBefore(ctx, time.Now().Add(30*time.Minute), 0)
+
+		if len(secrets) != 0 {
+			t.Fatalf("Deleted secrets should not be listed, got %v", secrets)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := store.Delete(ctx, "", "bar"); err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if contains, _ := store.Contains(ctx, "", "bar"); contains {
+			t.Fatal("Secret should have been deleted")
+		}
+
+		if err := store.Delete(ctx, "", "bar"); err != nil {
+			t.Fatalf("Deleting a not existing secret should not fail : %s", err)
+		}
+	})
+
+	t.Run("namespaces", func(t *testing.T) {
+		for _, namespace := range []string{"game", "chat"} {
+			secret := NewSecret("foo", time.Hour)
+			secret.Namespace = namespace
+			secret.Token = namespace + " token"
+
+			if err := store.Save(ctx, secret); err != nil {
+				t.Fatalf("Unexpected error : %s", err)
+			}
+		}
+
+		expiring := NewSecret("expired", -time.Minute)
+		expiring.Namespace = "game"
+		store.Save(ctx, expiring)
+
+		fetched, err := store.Fetch(ctx, "game", "foo")
+
+		if err != nil {
+			t.Fatalf("Unexpected error : %s", err)
+		}
+
+		if fetched.Namespace != "game" || fetched.Token != "game token" {
+			t.Fatalf("Fetched secret differs from the saved one : %v", fetched)
+		}
+
+		if fetched, _ := store.Fetch(ctx, "", "foo"); fetched.Namespace != "" || fetched.Token != "conditional token" {
+			t.Fatalf("Secret of the default namespace should be kept, got %v", fetched)
+		}
+
+		if contains, _ := store.Contains(ctx, "other", "foo"); contains {
+			t.Fatal("Store should not contain a secret of another namespace")
+		}
+
+		listed := func(options ListOptions) []string {
+			secrets, err := store.List(ctx, options)
+
+			if err != nil {
+				t.Fatalf("Unexpected error : %s", err)
+			}
+
+			names := make([]string, 0, len(secrets))
+
+			for _, secret := range secrets {
+				names = append(names, secret.Namespace+"/"+secret.Name)
+			}
+
+			sort.Strings(names)
+
+			return names
+		}
+
+		if names := listed(ListOptions{}); !reflect.DeepEqual(names, []string{"/My Secret", "/foo"}) {
+			t.Fatalf("Expected [/My Secret /foo], got %v", names)
+		}
+
+		if names := listed(ListOptions{Namespace: "game"}); !reflect.DeepEqual(names, []string{"game/expired", "game/foo"}) {
+			t.Fatalf("Expected [game/expired game/foo], got %v", names)
+		}
+
+		if names := listed(ListOptions{AllNamespaces: true}); len(names) != 5 {
+			t.Fatalf("Expected the secrets of every namespace, got %v", names)
+		}
+
+		if secrets, _ := store.ListExpiringBefore(ctx, time.Now(), 0); len(secrets) != 1 || secrets[0].Namespace != "game" {
+			t.Fatalf("Expected [game/expired], got %v", secrets)
+		}
+
+		store.Delete(ctx, "game", "foo")
+		store.Delete(ctx, "game", "expired")
+
+		if contains, _ := store.Contains(ctx, "chat", "foo"); !contains {
+			t.Fatal("Secret of another namespace should not have been deleted")
+		}
+
+		store.Delete(ctx, "chat", "foo")
+
+		if names := listed(ListOptions{AllNamespaces: true}); len(names) != 2 {
+			t.Fatalf("Expected the secrets of the default namespace only, got %v", names)
+		}
+	})
+
+	t.Run("labels", func(t *testing.T) {
+		secrets := map[string]map[string]string{
+			"eu-1":   {"game": "foo", "region": "eu"},
+			"us-1":   {"game": "foo", "region": "us", "tier": "2"},
+			"asia-1": {"game": "bar", "region": "asia"},
+		}
+
+		for name, secretLabels := range secrets {
+			secret := NewSecret(name, time.Hour)
+			secret.Labels = secretLabels
+			store.Save(ctx, secret)
+		}
+
+		namespaced := NewSecret("eu-1", time.Hour)
+		namespaced.Namespace = "game"
+		namespaced.Labels = map[string]string{"game": "foo"}
+		store.Save(ctx, namespaced)
+
+		if fetched, _ := store.Fetch(ctx, "", "us-1"); !reflect.DeepEqual(fetched.Labels, secrets["us-1"]) {
+			t.Fatalf("Fetched labels differ from the saved ones : %v", fetched.Labels)
+		}
+
+		selected := func(selector string) []string {
+			parsed, err := labels.Parse(selector)
+
+			if err != nil {
+				t.Fatalf("Unexpected error : %s", err)
+			}
+
+			secrets, err := store.List(ctx, ListOptions{Selector: parsed})
+
+			if err != nil {
+				t.Fatalf("Unexpected error : %s", err)
+			}
+
+			names := make([]string, 0, len(secrets))
+
+			for _, secret := range secrets {
+				names = append(names, secret.Name)
+			}
+
+			sort.Strings(names)
+
+			return names
+		}
+
+		tests := map[string][]string{
+			"game=foo":                      {"eu-1", "us-1"},
+			"game==foo,region in (eu,asia)": {"eu-1"},
+			"game!=foo":                     {"My Secret", "asia-1", "foo"},
+			"region notin (eu,us)":          {"My Secret", "asia-1", "foo"},
+			"tier":                          {"us-1"},
+			"game,!tier":                    {"asia-1", "eu-1"},
+			"tier>1":                        {"us-1"},
+			"game=baz":                      {},
+		}
+
+		for selector, expected := range tests {
+			if names := selected(selector); !reflect.DeepEqual(names, expected) {
+				t.Fatalf("Expected %v for \"%s\", got %v", expected, selector, names)
+			}
+		}
+
+		relabeled := NewSecret("us-1", time.Hour)
+		relabeled.Labels = map[string]string{"game": "bar"}
+		store.Save(ctx, relabeled)
+		store.Delete(ctx, "", "eu-1")
+
+		if names := selected("game=foo"); len(names) != 0 {
+			t.Fatalf("Expected the previous labels not to be selected, got %v", names)
+		}
+
+		if names := selected("game=bar,!region"); !reflect.DeepEqual(names, []string{"us-1"}) {
+			t.Fatalf("Expected [us-1], got %v", names)
+		}
+
+		store.Delete(ctx, "", "us-1")
+		store.Delete(ctx, "", "asia-1")
+		store.Delete(ctx, "game", "eu-1")
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			secret := NewSecret(fmt.Sprintf("p-%d", i), time.Duration(5-i)*time.Hour)
+			secret.Namespace = "paged"
+			secret.Labels = map[string]string{"tier": strconv.Itoa(i)}
+			store.Save(ctx, secret)
+		}
+
+		other := NewSecret("p-0", time.Hour)
+		other.Namespace = "paged-other"
+		store.Save(ctx, other)
+
+		// paged lists every page of the secrets, until a page is shorter than the asked size
+		paged := func(options ListOptions, page PageOptions) []string {
+			var names []string
+
+			for {
+				secrets, err := store.ListPage(ctx, options, page)
+
+				if err != nil {
+					t.Fatalf("Unexpected error : %s", err)
+				}
+
+				for _, secret := range secrets {
+					names = append(names, secret.Namespace+"/"+secret.Name)
+				}
+
+				if page.Size == 0 || len(secrets) < page.Size {
+					return names
+				}
+
+				cursor := newPageCursor(secrets[len(secrets)-1])
+				page.After = &cursor
+			}
+		}
+
+		byName := []string{"paged/p-0", "paged/p-1", "paged/p-2", "paged/p-3", "paged/p-4"}
+
+		if names := paged(ListOptions{Namespace: "paged"}, PageOptions{Size: 2}); !reflect.DeepEqual(names, byName) {
+			t.Fatalf("Expected %v, got %v", byName, names)
+		}
+
+		byExpiry := []string{"paged/p-4", "paged/p-3", "paged/p-2", "paged/p-1", "paged/p-0"}
+
+		if names := paged(ListOptions{Namespace: "paged"}, PageOptions{OrderBy: OrderByExpiry, Size: 2}); !reflect.DeepEqual(names, byExpiry) {
+			t.Fatalf("Expected %v, got %v", byExpiry, names)
+		}
+
+		selector, _ := labels.Parse("tier>1")
+		selected := []string{"paged/p-2", "paged/p-3", "paged/p-4"}
+
+		if names := paged(ListOptions{Namespace: "paged", Selector: selector}, PageOptions{Size: 1}); !reflect.DeepEqual(names, selected) {
+			t.Fatalf("Expected %v, got %v", selected, names)
+		}
+
+		// the default namespace comes first, and a namespace before the longer ones it prefixes
+		all := append(append([]string{"/My Secret", "/foo"}, byName...), "paged-other/p-0")
+
+		if names := paged(ListOptions{AllNamespaces: true}, PageOptions{Size: 3}); !reflect.DeepEqual(names, all) {
+			t.Fatalf("Expected %v, got %v", all, names)
+		}
+
+		if names := paged(ListOptions{AllNamespaces: true}, PageOptions{}); !reflect.DeepEqual(names, all) {
+			t.Fatalf("Expected every secret in a single page, got %v", names)
+		}
+
+		for i := 0; i < 5; i++ {
+			store.Delete(ctx, "paged", fmt.Sprintf("p-%d", i))
+		}
+
+		store.Delete(ctx, "paged-other", "p-0")
+	})
+
+	if batch, ok := store.(BatchStore); ok {
+		t.Run("batch", func(t *testing.T) {
+			first := NewSecret("first", time.Hour)
+			second := NewSecret("second", time.Hour)
+			second.Namespace = "game"
+			stale := NewSecret("foo", time.Hour)
+			stale.Revision = 42
+
+			if err := batch.SaveAll(ctx, []Secret{first, second, stale}); !errors.Is(err, ErrSecretConflict) {
+				t.Fatalf("Expected a conflict, got %v", err)
+			}
+
+			if contains, _ := store.Contains(ctx, "", "first"); contains {
+				t.Fatal("No secret should be saved when one of them conflicts")
+			}
+
+			if err := batch.SaveAll(ctx, []Secret{first, second}); err != nil {
+				t.Fatalf("Unexpected error : %s", err)
+			}
+
+			for _, secret := range []Secret{first, second} {
+				if fetched, err := store.Fetch(ctx, secret.Namespace, secret.Name); err != nil || fetched.Revision != 1 {
+					t.Fatalf("Expected the saved secret, got %v (%v)", fetched, err)
+				}
+			}
+
+			third := NewSecret("third", time.Hour)
+
+			if err := batch.CreateAll(ctx, []Secret{third, first}); !errors.Is(err, ErrSecretExists) {
+				t.Fatalf("Expected %s, got %v", ErrSecretExists, err)
+			}
+
+			if contains, _ := store.Contains(ctx, "", "third"); contains {
+				t.Fatal("No secret should be created when one of them exists")
+			}
+
+			if err := batch.DeleteAll(ctx, []Secret{first, second, {Name: "not existing"}}); err != nil {
+				t.Fatalf("Unexpected error : %s", err)
+			}
+
+			for _, secret := range []Secret{first, second} {
+				if contains, _ := store.Contains(ctx, secret.Namespace, secret.Name); contains {
+					t.Fatalf("Secret \"%s\" should have been deleted", secret.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestSecretStore(t *testing.T) {
+	testSecretStore(t, NewSecretStore())
+}
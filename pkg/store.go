@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	"github.com/Taluu/challenge-jwt/pkg/secrets"
+	"github.com/go-redis/redis/v8"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// openSecretStore opens the store described by dsn, which is either "memory://",
+// "kubernetes://<namespace>", "bolt://<path>", "sqlite://<path>", a postgres connection URL, or a
+// redis one (with an optional "prefix" parameter for the keys).
+func openSecretStore(ctx context.Context, dsn string) (secrets.SecretStore, error) {
+	storeURL, err := url.Parse(dsn)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid store \"%s\" : %w", dsn, err)
+	}
+
+	switch storeURL.Scheme {
+	case "memory":
+		return secrets.NewSecretStore(), nil
+
+	case "kubernetes":
+		if storeURL.Host == "" {
+			return nil, fmt.Errorf("invalid store \"%s\" : missing namespace", dsn)
+		}
+
+		client, err := newKubernetesClient()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return secrets.NewCachedKubernetesSecretStore(ctx, client, storeURL.Host)
+
+	case "bolt":
+		path := storeURL.Host + storeURL.Path
+
+		if path == "" {
+			return nil, fmt.Errorf("invalid store \"%s\" : missing database path", dsn)
+		}
+
+		return secrets.NewBoltSecretStore(path)
+
+	case "sqlite":
+		path := storeURL.Host + storeURL.Path
+
+		if path == "" {
+			return nil, fmt.Errorf("invalid store \"%s\" : missing database path", dsn)
+		}
+
+		db, err := sql.Open("sqlite", secrets.SQLiteDSN(path))
+
+		if err != nil {
+			return nil, err
+		}
+
+		return secrets.NewSQLSecretStore(ctx, db, "sqlite")
+
+	case "postgres", "postgresql":
+		db, err := sql.Open("postgres", dsn)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return secrets.NewSQLSecretStore(ctx, db, "postgres")
+
+	case "redis", "rediss":
+		query := storeURL.Query()
+		prefix := query.Get("prefix")
+
+		query.Del("prefix")
+		storeURL.RawQuery = query.Encode()
+
+		options, err := redis.ParseURL(storeURL.String())
+
+		if err != nil {
+			return nil, err
+		}
+
+		return secrets.NewRedisSecretStore(redis.NewClient(options), prefix), nil
+	}
+
+	return nil, fmt.Errorf("unsupported store \"%s\"", dsn)
+}